@@ -1,5 +1,7 @@
 package photomgr
 
+import "time"
+
 type PostDoc struct {
 	ArticleID    string   `json:"article_id" bson:"article_id"`
 	ArticleTitle string   `json:"article_title" bson:"article_title"`
@@ -9,4 +11,7 @@ type PostDoc struct {
 	ImageLinks   []string `json:"image_links" bson:"image_links"`
 	Likeint      int      `json:"likeint" bson:"likeint"`
 	Dislikeint   int      `json:"dislikeint" bson:"dislikeint"`
+	// Time is the normalized post time, from the PTT M.<unix>.A.XXX article
+	// ID or the listed date. Zero if unknown.
+	Time time.Time `json:"time" bson:"time"`
 }
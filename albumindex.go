@@ -0,0 +1,74 @@
+package photomgr
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// AlbumIndexFileName is the name of the ordered image list in every album
+// folder.
+const AlbumIndexFileName = "index.json"
+
+// AlbumIndex lists the saved images of an album in the order of the post, so
+// a viewer can show the album as the author intended whatever the file
+// names.
+type AlbumIndex struct {
+	Title  string            `json:"title"`
+	URL    string            `json:"url"`
+	Images []AlbumIndexImage `json:"images"`
+}
+
+// AlbumIndexImage is a saved image of an AlbumIndex.
+type AlbumIndexImage struct {
+	// Seq is the position of the image in the post, from 1. Images which
+	// are not saved, such as the skipped ones, leave a gap.
+	Seq    int    `json:"seq"`
+	File   string `json:"file"` // Name in the album folder
+	URL    string `json:"url"`
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+}
+
+// newAlbumIndex returns the index of the saved images of a download.
+func newAlbumIndex(report *DownloadReport) *AlbumIndex {
+	index := &AlbumIndex{Title: report.Title, URL: report.Target, Images: []AlbumIndexImage{}}
+	for i, image := range report.Images {
+		if image.Path == "" {
+			continue
+		}
+		index.Images = append(index.Images, AlbumIndexImage{
+			Seq:    i + 1,
+			File:   filepath.Base(image.Path),
+			URL:    image.URL,
+			Width:  image.Width,
+			Height: image.Height,
+		})
+	}
+	return index
+}
+
+// LoadAlbumIndex reads the ordered image list of album folder dir.
+func LoadAlbumIndex(dir string) (*AlbumIndex, error) {
+	path := filepath.Join(dir, AlbumIndexFileName)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	index := new(AlbumIndex)
+	if err := json.Unmarshal(data, index); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrParseFailed, path, err)
+	}
+	return index, nil
+}
+
+// writeAlbumIndex writes the ordered image list of a download into its album
+// folder.
+func writeAlbumIndex(report *DownloadReport) error {
+	data, err := json.MarshalIndent(newAlbumIndex(report), "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(report.Dir, AlbumIndexFileName), data)
+}
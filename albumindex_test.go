@@ -0,0 +1,84 @@
+package photomgr
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newAlbumIndexTestServer serves a CK101 thread of two different images both
+// named img.jpg on two hosts, with a small image between them.
+func newAlbumIndexTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	first := encodeTestImage(t, "jpg", 400, 400)
+	second := encodeTestImage(t, "jpg", 500, 400)
+	small := encodeTestImage(t, "png", 10, 10)
+
+	images := map[string][]byte{"/a/img.jpg": first, "/b/img.jpg": second, "/small.png": small}
+	return newCK101TestServer(t, images, "/a/img.jpg", "/small.png", "/b/img.jpg")
+}
+
+func TestDownload_AlbumIndex(t *testing.T) {
+	server := newAlbumIndexTestServer(t)
+	c := NewCK101()
+	c.BaseDir = t.TempDir()
+	target := server.URL + ck101TestThread
+	report, err := c.Download(context.Background(), target, 3, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	index, err := LoadAlbumIndex(report.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []AlbumIndexImage{
+		{Seq: 1, File: "001.jpg", URL: server.URL + "/a/img.jpg", Width: 400, Height: 400},
+		{Seq: 3, File: "003.jpg", URL: server.URL + "/b/img.jpg", Width: 500, Height: 400},
+	}
+	if index.Title != "Album" || index.URL != target || fmt.Sprint(index.Images) != fmt.Sprint(expected) {
+		t.Errorf("Expected index images %+v, got %+v", expected, index)
+	}
+
+	manifest, err := LoadManifest(report.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry, _ := manifest.Entry(server.URL + "/b/img.jpg"); entry.Seq != 3 {
+		t.Errorf("Expected seq 3 in the manifest, got %+v", entry)
+	}
+}
+
+func TestDownload_SameFileName(t *testing.T) {
+	server := newAlbumIndexTestServer(t)
+	c := NewCK101()
+	c.BaseDir = t.TempDir()
+	c.Naming = MustParseNameTemplate("CK101 - {title}/{name}.{ext}")
+	report, err := c.Download(context.Background(), server.URL+ck101TestThread, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The second img.jpg does not overwrite the first one.
+	if filepath.Base(report.Images[0].Path) != "img.jpg" || filepath.Base(report.Images[2].Path) != "img-2.jpg" {
+		t.Fatalf("Expected img.jpg and img-2.jpg, got %s and %s", report.Images[0].Path, report.Images[2].Path)
+	}
+	for _, i := range []int{0, 2} {
+		info, err := os.Stat(report.Images[i].Path)
+		if err != nil || info.Size() != report.Images[i].Size {
+			t.Errorf("Expected %s of %d bytes, got %v, err %v", report.Images[i].Path, report.Images[i].Size, info, err)
+		}
+	}
+
+	// A second run keeps the names.
+	again, err := c.Download(context.Background(), server.URL+ck101TestThread, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Images[2].Path != report.Images[2].Path {
+		t.Errorf("Expected %s again, got %s", report.Images[2].Path, again.Images[2].Path)
+	}
+}
@@ -1,17 +1,16 @@
 package photomgr
 
 import (
-	"image"
-	"image/gif"
-	"image/jpeg"
-	"image/png"
+	"context"
+	"fmt"
 	"log"
 	"net/http"
-	"os"
-	"path/filepath"
 	"regexp"
 	"strings"
 	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
 )
 
 type baseCrawler struct {
@@ -20,125 +19,352 @@ type baseCrawler struct {
 	baseAddress  string
 	entryAddress string
 
-	// //To store current baseCrawler post result
+	// storedPost is the result of the last Parse* listing call, read back by
+	// the index getters. The List* methods return their posts instead and
+	// leave it as is. Guarded by postMu.
+	postMu     sync.RWMutex
 	storedPost []PostDoc
 }
 
 var (
 	threadId = regexp.MustCompile(`M.(\d*).`)
 	// Updated to include jpeg extension.
-	imageId  = regexp.MustCompile(`([^\/]+)\.(png|jpg|jpeg)`)
+	imageId = regexp.MustCompile(`([^\/]+)\.(png|jpg|jpeg)`)
 )
 
 func (b *baseCrawler) HasValidURL(url string) bool {
 	return threadId.Match([]byte(url))
 }
 
+// setPosts replaces the stored result with posts and returns the count.
+func (b *baseCrawler) setPosts(posts []PostDoc) int {
+	b.postMu.Lock()
+	defer b.postMu.Unlock()
+	if posts == nil {
+		posts = []PostDoc{}
+	}
+	b.storedPost = posts
+	return len(b.storedPost)
+}
+
+// appendPosts adds posts to the stored result and returns the count.
+func (b *baseCrawler) appendPosts(posts []PostDoc) int {
+	b.postMu.Lock()
+	defer b.postMu.Unlock()
+	b.storedPost = append(b.storedPost, posts...)
+	return len(b.storedPost)
+}
+
+// storedPosts returns a copy of the stored result.
+func (b *baseCrawler) storedPosts() []PostDoc {
+	b.postMu.RLock()
+	defer b.postMu.RUnlock()
+	return append([]PostDoc(nil), b.storedPost...)
+}
+
+// post returns the stored post at postIndex.
+func (b *baseCrawler) post(postIndex int) (PostDoc, bool) {
+	b.postMu.RLock()
+	defer b.postMu.RUnlock()
+	if postIndex < 0 || postIndex >= len(b.storedPost) {
+		return PostDoc{}, false
+	}
+	return b.storedPost[postIndex], true
+}
+
 // Return parse page result count, it will be 0 if you still not parse any page
 func (b *baseCrawler) GetCurrentPageResultCount() int {
+	b.postMu.RLock()
+	defer b.postMu.RUnlock()
 	return len(b.storedPost)
 }
 
 // Get post title by index in current parsed page
 func (b *baseCrawler) GetPostTitleByIndex(postIndex int) string {
-	if postIndex >= len(b.storedPost) {
-		return ""
-	}
-	return b.storedPost[postIndex].ArticleTitle
+	post, _ := b.post(postIndex)
+	return post.ArticleTitle
 }
 
 // Get post URL by index in current parsed page
 func (b *baseCrawler) GetPostUrlByIndex(postIndex int) string {
-	if postIndex >= len(b.storedPost) {
-		return ""
-	}
-
-	return b.storedPost[postIndex].URL
+	post, _ := b.post(postIndex)
+	return post.URL
 }
 
 // Get post like count by index in current parsed page
 func (b *baseCrawler) GetPostStarByIndex(postIndex int) int {
-	if postIndex >= len(b.storedPost) {
+	post, _ := b.post(postIndex)
+	return post.Likeint
+}
+
+// Get post author by index in current parsed page
+func (b *baseCrawler) GetPostAuthorByIndex(postIndex int) string {
+	post, _ := b.post(postIndex)
+	return post.Author
+}
+
+// Get post date, as shown in the listing, by index in current parsed page
+func (b *baseCrawler) GetPostDateByIndex(postIndex int) string {
+	post, _ := b.post(postIndex)
+	return post.Date
+}
+
+// Get post unix time by index in current parsed page, 0 if unknown
+func (b *baseCrawler) GetPostUnixTimeByIndex(postIndex int) int {
+	post, ok := b.post(postIndex)
+	if !ok || post.Time.IsZero() {
 		return 0
 	}
-	return b.storedPost[postIndex].Likeint
+	return int(post.Time.Unix())
 }
 
-func exists(path string) (bool, error) {
-	_, err := os.Stat(path)
-	if err == nil {
-		return true, nil
+// fetchDocument gets target and parses it as HTML document, the cookies are
+// added to the request (PTT needs over18=1).
+func fetchDocument(ctx context.Context, target string, cookies ...*http.Cookie) (*goquery.Document, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", target, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating GET request for %s: %w", target, err)
+	}
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+
+	resp, err := DefaultHTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error performing GET request for %s: %w", target, err)
 	}
-	if os.IsNotExist(err) {
-		return false, nil
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(target, resp.StatusCode)
+	}
+
+	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrParseFailed, target, err)
 	}
-	return true, err
+	return doc, nil
 }
 
-func (b *baseCrawler) worker(destDir string, linkChan chan string, wg *sync.WaitGroup) {
-	defer wg.Done()
+// fileNamer returns the file name of the image at index of a post, with
+// the extension of format. See NameTemplate.
+type fileNamer func(index int, target string, format string) string
 
-	for target := range linkChan {
-		req, err := http.NewRequest("GET", target, nil)
-		if err != nil {
-			log.Printf("http.NewRequest error: %s, target: %s", err, target)
+// downloadOptions are the per site settings of downloadImages.
+type downloadOptions struct {
+	// names names the files, or after the image URL if nil.
+	names fileNamer
+	// filter selects the saved images, DefaultImageFilter if nil.
+	filter *ImageFilter
+}
+
+// downloadImages downloads images into report.Dir through the download
+// manager of ctx, see DownloadManager, with at most workerNum of them in
+// flight at once, or the pool size if workerNum < 1. Files are named and
+// filtered by opts. It fills report.Images with the result of every image in
+// order. The result of every image is recorded in the manifest of the folder,
+// and images already done or skipped in it are not downloaded again, unless
+// their file is gone or they were skipped under another filter. Images
+// already in lib are hard linked instead of stored again, lib may be nil.
+// Events are sent to progress if not nil. Once ctx is done it removes its
+// images still queued, waits only for the started ones and returns ctx.Err().
+func (b *baseCrawler) downloadImages(ctx context.Context, lib *Library, report *DownloadReport, images []string, opts downloadOptions, workerNum int, progress ProgressFunc) error {
+	manager, priority := downloadManagerFrom(ctx)
+	if workerNum < 1 {
+		workerNum = manager.Workers()
+	}
+	report.Started = time.Now()
+	report.Images = make([]ImageResult, len(images))
+
+	manifest, err := LoadManifest(report.Dir)
+	if err != nil {
+		return err
+	}
+	if err := manifest.adoptFiles(report.Dir, images); err != nil {
+		log.Printf("manifest error: %s, album: %s", err, report.Dir)
+	}
+
+	// Images skipped under another filter may be kept by this one.
+	recheck := !manifest.sameFilter(opts.filter)
+	var jobs []imageJob
+	for i, url := range images {
+		entry, ok := manifest.Entry(url)
+		switch {
+		case ok && entry.Status == ImageDone && !entry.saved(report.Dir, lib):
+			log.Printf("%s: the file of %s is missing, download it again", report.Dir, url)
+		case ok && (entry.Status == ImageDone || entry.Status == ImageSkipped && !recheck):
+			report.Images[i] = resultFromManifest(report.Dir, entry)
+			report.Images[i].Resumed = true
 			continue
 		}
-		// Set User-Agent header
-		req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
-		// Set Referer header if target is from i.imgur.com
-		if strings.Contains(target, "i.imgur.com") {
-			re := regexp.MustCompile(`([^\/]+)\.(jpg|jpeg|png)`)
-			matches := re.FindStringSubmatch(target)
-			if len(matches) >= 2 {
-				req.Header.Set("Referer", "https://imgur.com/"+matches[1])
-			}
+		report.Images[i] = ImageResult{URL: url, Status: ImagePending}
+		jobs = append(jobs, imageJob{index: i, url: url})
+	}
+	if len(jobs) < len(images) {
+		log.Printf("%s: %d of %d images already downloaded", report.Dir, len(images)-len(jobs), len(images))
+	}
+
+	events := &progressSender{
+		progress: progress,
+		event:    DownloadEvent{Target: report.Target, Dir: report.Dir, Total: len(images), Completed: len(images) - len(jobs)},
+	}
+	events.send(DownloadStarted, nil)
+
+	inFlight := make(chan struct{}, workerNum)
+	wg := new(sync.WaitGroup)
+	var queued []*task
+feed:
+	for _, job := range jobs {
+		select {
+		case inFlight <- struct{}{}:
+		case <-ctx.Done():
+			break feed
 		}
 
-		client := &http.Client{}
-		resp, err := client.Do(req)
+		job := job
+		wg.Add(1)
+		var t *task
+		t, err = manager.submit(priority, func() {
+			defer wg.Done()
+			defer func() { <-inFlight }()
+			// Images queued before a cancel stay pending.
+			if ctx.Err() == nil {
+				b.downloadImage(ctx, lib, report, manifest, events, opts, job)
+			}
+		})
 		if err != nil {
-			log.Printf("client.Do error: %s, target: %s", err, target)
-			continue
+			wg.Done()
+			break
 		}
-		defer resp.Body.Close()
+		queued = append(queued, t)
+	}
 
-		m, _, err := image.Decode(resp.Body)
-		if err != nil {
-			m, err = png.Decode(resp.Body)
-			if err != nil {
-				log.Printf("image.Decode error: %s, target: %s", err, target)
-				continue
-			}
+	// A cancelled download does not wait behind the other downloads for its
+	// queued images to be popped.
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		for n := manager.cancel(queued); n > 0; n-- {
+			wg.Done()
 		}
+		<-finished
+	}
+	// Only a complete run checked every skipped image with the filter.
+	if err == nil && ctx.Err() == nil {
+		if err := manifest.setFilter(opts.filter); err != nil {
+			log.Printf("manifest error: %s, album: %s", err, report.Dir)
+		}
+	}
+	report.Finished = time.Now()
+	events.event.Report = report
+	events.send(DownloadFinished, nil)
+	if err != nil {
+		return err
+	}
+	return ctx.Err()
+}
 
-		// Ignore small images
-		bounds := m.Bounds()
-		if bounds.Size().X > 300 && bounds.Size().Y > 300 {
-			imgInfo := imageId.FindStringSubmatch(target)
-			if len(imgInfo) < 3 {
-				log.Printf("imageId regex did not match target: %s", target)
-				continue
-			}
-			ext := imgInfo[2]
-			if ext == "jpeg" {
-				ext = "jpg"
-			}
-			finalPath := destDir + "/" + imgInfo[1] + "." + ext
-			out, err := os.Create(filepath.FromSlash(finalPath))
-			if err != nil {
-				log.Printf("os.Create error: %s", err)
-				continue
-			}
-			defer out.Close()
-			switch ext {
-			case "jpg":
-				jpeg.Encode(out, m, nil)
-			case "png":
-				png.Encode(out, m)
-			case "gif":
-				gif.Encode(out, m, nil)
-			}
+// imageJob is an image to download at index of the report.
+type imageJob struct {
+	index int
+	url   string
+}
+
+// progressSender serializes the events of the workers of a download.
+type progressSender struct {
+	progress ProgressFunc
+	mu       sync.Mutex
+	event    DownloadEvent
+}
+
+func (s *progressSender) send(typ DownloadEventType, image *ImageResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if typ == DownloadProgress {
+		s.event.Completed++
+	}
+	if s.progress == nil {
+		return
+	}
+	event := s.event
+	event.Type, event.Image = typ, image
+	s.progress(event)
+}
+
+// downloadImage saves the image of job and records its result.
+func (b *baseCrawler) downloadImage(ctx context.Context, lib *Library, report *DownloadReport, manifest *Manifest, events *progressSender, opts downloadOptions, job imageJob) {
+	name := func(format string) string {
+		file := imageFileName(job.url, format)
+		if opts.names != nil {
+			file = opts.names(job.index, job.url, format)
+		}
+		return manifest.claimFile(file, job.url)
+	}
+	saved, err := saveImage(ctx, lib, report.Dir, job.url, name, opts.filter.orDefault())
+	entry := ManifestEntry{URL: job.url, Seq: job.index + 1}
+	switch {
+	case err != nil:
+		log.Printf("saveImage error: %s, target: %s", err, job.url)
+		entry.Status, entry.Error = ImageFailed, err.Error()
+	case saved.Skipped != "":
+		log.Printf("skip image: %s, target: %s", saved.Skipped, job.url)
+		entry.Status, entry.Error = ImageSkipped, saved.Skipped
+	default:
+		entry.Status, entry.File, entry.Size, entry.SHA256 = ImageDone, saved.File, saved.Size, saved.SHA256
+		entry.DuplicateOf = saved.DuplicateOf
+	}
+	entry.Width, entry.Height = saved.Width, saved.Height
+	if err := manifest.Record(entry); err != nil {
+		log.Printf("manifest error: %s, target: %s", err, job.url)
+	}
+
+	// Every job has its own index, so concurrent jobs never write the same
+	// result.
+	result := resultFromManifest(report.Dir, entry)
+	result.Err = err
+	report.Images[job.index] = result
+	events.send(DownloadProgress, &result)
+}
+
+// saveImage downloads a single image into destDir as is, images not kept by
+// filter are skipped, see writeImage.
+func saveImage(ctx context.Context, lib *Library, destDir string, target string, name func(format string) string, filter *ImageFilter) (savedImage, error) {
+	filter = filter.orDefault()
+	req, err := http.NewRequestWithContext(ctx, "GET", target, nil)
+	if err != nil {
+		return savedImage{}, fmt.Errorf("http.NewRequest error: %w", err)
+	}
+	// Set User-Agent header
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
+	// Set Referer header if target is from i.imgur.com
+	if strings.Contains(target, "i.imgur.com") {
+		matches := imageId.FindStringSubmatch(target)
+		if len(matches) >= 2 {
+			req.Header.Set("Referer", "https://imgur.com/"+matches[1])
 		}
 	}
+
+	resp, err := DefaultHTTPClient.Do(req)
+	if err != nil {
+		return savedImage{}, fmt.Errorf("client.Do error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return savedImage{}, statusError(target, resp.StatusCode)
+	}
+	if reason := filter.checkURL(resp.Request.URL); reason != "" {
+		return savedImage{Skipped: reason}, nil
+	}
+	if reason := filter.checkLength(resp.ContentLength); reason != "" {
+		return savedImage{Skipped: reason}, nil
+	}
+
+	return writeImage(lib, destDir, target, name, filter, resp.Body)
 }
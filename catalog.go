@@ -0,0 +1,474 @@
+package photomgr
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// CatalogFileName is the name of the catalog database in the base folder.
+const CatalogFileName = ".photomgr-catalog.db"
+
+var (
+	catalogPostsBucket  = []byte("posts")  // post URL -> CatalogPost
+	catalogImagesBucket = []byte("images") // post URL -> bucket of seq -> CatalogImage
+	catalogRunsBucket   = []byte("runs")   // run ID -> CrawlRun
+)
+
+// CatalogPost is a downloaded post in the catalog.
+type CatalogPost struct {
+	PostDoc
+	Site  string `json:"site"` // Registered site name, such as "ptt"
+	Board string `json:"board,omitempty"`
+	// Dir is the album folder, relative to the catalog root when inside it.
+	Dir       string    `json:"dir"`
+	CrawledAt time.Time `json:"crawled_at"`
+}
+
+// CatalogImage is an image of a post in the catalog.
+type CatalogImage struct {
+	URL     string `json:"url"`
+	PostURL string `json:"post_url"`
+	Seq     int    `json:"seq"` // Position in the post, from 1
+	Status  string `json:"status"`
+	// Path is the saved file, relative to the catalog root when inside it.
+	Path        string `json:"path,omitempty"`
+	SHA256      string `json:"sha256,omitempty"`
+	Width       int    `json:"width,omitempty"`
+	Height      int    `json:"height,omitempty"`
+	Size        int64  `json:"size,omitempty"`
+	DuplicateOf string `json:"duplicate_of,omitempty"`
+}
+
+// CrawlRun is a download of a post in the catalog.
+type CrawlRun struct {
+	ID       uint64    `json:"id"`
+	Site     string    `json:"site"`
+	Target   string    `json:"target"`
+	Dir      string    `json:"dir"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	Done     int       `json:"done"`
+	Skipped  int       `json:"skipped"`
+	Failed   int       `json:"failed"`
+	Pending  int       `json:"pending"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// CatalogQuery selects posts of the catalog, zero fields match every post.
+type CatalogQuery struct {
+	Site  string
+	Board string // Case-insensitive
+	// Author is the author ID, case-insensitive.
+	Author string
+	// From and To select the posts with a Time in [From, To). Posts without
+	// a time never match a time range.
+	From, To  time.Time
+	MinPushes int    // Minimum Likeint
+	Keyword   string // Case-insensitive substring of the title
+	Limit     int    // Maximum number of posts, 0 for all
+}
+
+func (q CatalogQuery) match(post *CatalogPost) bool {
+	switch {
+	case q.Site != "" && post.Site != q.Site:
+		return false
+	case q.Board != "" && !strings.EqualFold(post.Board, q.Board):
+		return false
+	case q.Author != "" && !strings.EqualFold(post.Author, q.Author):
+		return false
+	case (!q.From.IsZero() || !q.To.IsZero()) && post.Time.IsZero():
+		return false
+	case !q.From.IsZero() && post.Time.Before(q.From):
+		return false
+	case !q.To.IsZero() && !post.Time.Before(q.To):
+		return false
+	case post.Likeint < q.MinPushes:
+		return false
+	case q.Keyword != "" && !strings.Contains(strings.ToLower(post.ArticleTitle), strings.ToLower(q.Keyword)):
+		return false
+	}
+	return true
+}
+
+// Catalog is the database of every post downloaded under a base folder, with
+// its images and the crawl runs, so the archive can be searched without
+// scanning the album folders. Every Download updates the catalog of its base
+// folder. It is an embedded bbolt database and safe for concurrent use.
+type Catalog struct {
+	root string
+	db   *bolt.DB
+}
+
+var (
+	catalogsMu sync.Mutex
+	catalogs   = make(map[string]*Catalog)
+	// catalogFailures is the time of the last failed open of catalogFor by
+	// root.
+	catalogFailures = make(map[string]time.Time)
+)
+
+// catalogRetryDelay is how long downloads go on without the catalog of a root
+// after failing to open it, such as when another process holds its lock, so
+// every download does not wait for the lock again.
+const catalogRetryDelay = time.Minute
+
+// OpenCatalog returns the catalog of base folder root, all callers in the
+// process share the same instance for a root. The database is locked while
+// open, another process opening it fails after a second.
+func OpenCatalog(root string) (*Catalog, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	catalogsMu.Lock()
+	defer catalogsMu.Unlock()
+	if c, ok := catalogs[root]; ok {
+		return c, nil
+	}
+
+	db, err := bolt.Open(filepath.Join(root, CatalogFileName), 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open catalog: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{catalogPostsBucket, catalogImagesBucket, catalogRunsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	c := &Catalog{root: root, db: db}
+	catalogs[root] = c
+	return c, nil
+}
+
+// catalogFor returns the catalog of base folder root, or nil after logging
+// the error so downloads go on without cataloging. After a failed open it
+// returns nil for catalogRetryDelay without trying again.
+func catalogFor(root string) *Catalog {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		log.Printf("catalog error: %s, the download is not cataloged", err)
+		return nil
+	}
+	catalogsMu.Lock()
+	failed, ok := catalogFailures[abs]
+	catalogsMu.Unlock()
+	if ok && time.Since(failed) < catalogRetryDelay {
+		return nil
+	}
+
+	c, err := OpenCatalog(abs)
+	if err != nil {
+		log.Printf("catalog error: %s, downloads are not cataloged for %v", err, catalogRetryDelay)
+		catalogsMu.Lock()
+		catalogFailures[abs] = time.Now()
+		catalogsMu.Unlock()
+		return nil
+	}
+	return c
+}
+
+// Root returns the absolute base folder of the catalog.
+func (c *Catalog) Root() string {
+	return c.root
+}
+
+// Close closes the database, the next OpenCatalog of the root opens it again.
+func (c *Catalog) Close() error {
+	catalogsMu.Lock()
+	if catalogs[c.root] == c {
+		delete(catalogs, c.root)
+	}
+	catalogsMu.Unlock()
+	return c.db.Close()
+}
+
+// Path returns the absolute path of a Dir or Path of the catalog.
+func (c *Catalog) Path(file string) string {
+	if file == "" || filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.Join(c.root, filepath.FromSlash(file))
+}
+
+// rel returns path relative to the catalog root when it is inside it.
+func (c *Catalog) rel(path string) string {
+	if path == "" {
+		return ""
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if rel, err := filepath.Rel(c.root, abs); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(rel)
+	}
+	return path
+}
+
+// PutPost adds or replaces post, keyed by its URL.
+func (c *Catalog) PutPost(post CatalogPost) error {
+	if post.URL == "" {
+		return fmt.Errorf("catalog: post without URL")
+	}
+	return c.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(catalogPostsBucket), []byte(post.URL), post)
+	})
+}
+
+// Post returns the post of url, or an error wrapping ErrNotFound.
+func (c *Catalog) Post(url string) (CatalogPost, error) {
+	var post CatalogPost
+	err := c.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(catalogPostsBucket).Get([]byte(url))
+		if data == nil {
+			return fmt.Errorf("%w: %s is not in the catalog", ErrNotFound, url)
+		}
+		return json.Unmarshal(data, &post)
+	})
+	return post, err
+}
+
+// Posts returns the posts matching q, newest first. Posts without a time are
+// last.
+func (c *Catalog) Posts(q CatalogQuery) ([]CatalogPost, error) {
+	var posts []CatalogPost
+	err := c.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(catalogPostsBucket).ForEach(func(_, data []byte) error {
+			var post CatalogPost
+			if err := json.Unmarshal(data, &post); err != nil {
+				return err
+			}
+			if q.match(&post) {
+				posts = append(posts, post)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(posts, func(i, j int) bool {
+		if !posts[i].Time.Equal(posts[j].Time) {
+			return posts[i].Time.After(posts[j].Time)
+		}
+		return posts[i].URL < posts[j].URL
+	})
+	if q.Limit > 0 && len(posts) > q.Limit {
+		posts = posts[:q.Limit]
+	}
+	return posts, nil
+}
+
+// Images returns the images of the post of postURL in post order.
+func (c *Catalog) Images(postURL string) ([]CatalogImage, error) {
+	var images []CatalogImage
+	err := c.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(catalogImagesBucket).Bucket([]byte(postURL))
+		if bucket == nil {
+			return nil
+		}
+		// Keys are big-endian sequence numbers, so already in order.
+		return bucket.ForEach(func(_, data []byte) error {
+			var image CatalogImage
+			if err := json.Unmarshal(data, &image); err != nil {
+				return err
+			}
+			images = append(images, image)
+			return nil
+		})
+	})
+	return images, err
+}
+
+// ImagesByHash returns the saved images with content SHA-256 sum in every
+// post.
+func (c *Catalog) ImagesByHash(sum string) ([]CatalogImage, error) {
+	if sum == "" {
+		return nil, nil
+	}
+	var images []CatalogImage
+	err := c.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(catalogImagesBucket).ForEachBucket(func(name []byte) error {
+			return tx.Bucket(catalogImagesBucket).Bucket(name).ForEach(func(_, data []byte) error {
+				var image CatalogImage
+				if err := json.Unmarshal(data, &image); err != nil {
+					return err
+				}
+				if image.SHA256 == sum {
+					images = append(images, image)
+				}
+				return nil
+			})
+		})
+	})
+	return images, err
+}
+
+// PutImages replaces the images of the post of postURL.
+func (c *Catalog) PutImages(postURL string, images []CatalogImage) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		return putImages(tx, postURL, images)
+	})
+}
+
+func putImages(tx *bolt.Tx, postURL string, images []CatalogImage) error {
+	parent := tx.Bucket(catalogImagesBucket)
+	if parent.Bucket([]byte(postURL)) != nil {
+		if err := parent.DeleteBucket([]byte(postURL)); err != nil {
+			return err
+		}
+	}
+	bucket, err := parent.CreateBucket([]byte(postURL))
+	if err != nil {
+		return err
+	}
+	for i, image := range images {
+		image.PostURL, image.Seq = postURL, i+1
+		if err := putJSON(bucket, itob(uint64(image.Seq)), image); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddRun records run with a new ID, which is returned.
+func (c *Catalog) AddRun(run CrawlRun) (uint64, error) {
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		return addRun(tx, &run)
+	})
+	return run.ID, err
+}
+
+func addRun(tx *bolt.Tx, run *CrawlRun) error {
+	bucket := tx.Bucket(catalogRunsBucket)
+	id, err := bucket.NextSequence()
+	if err != nil {
+		return err
+	}
+	run.ID = id
+	return putJSON(bucket, itob(id), run)
+}
+
+// Runs returns the last limit crawl runs, newest first. A limit of 0 returns
+// every run.
+func (c *Catalog) Runs(limit int) ([]CrawlRun, error) {
+	var runs []CrawlRun
+	err := c.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(catalogRunsBucket).Cursor()
+		for k, data := cursor.Last(); k != nil && (limit <= 0 || len(runs) < limit); k, data = cursor.Prev() {
+			var run CrawlRun
+			if err := json.Unmarshal(data, &run); err != nil {
+				return err
+			}
+			runs = append(runs, run)
+		}
+		return nil
+	})
+	return runs, err
+}
+
+// RecordDownload stores the post of meta, its images from report and the
+// crawl run in one transaction. downloadErr is the error of the download,
+// if any.
+func (c *Catalog) RecordDownload(meta *PostMeta, report *DownloadReport, downloadErr error) error {
+	post := CatalogPost{
+		PostDoc: PostDoc{
+			ArticleID:    meta.ArticleID,
+			ArticleTitle: meta.Title,
+			Author:       meta.Author,
+			Date:         meta.Date,
+			URL:          meta.URL,
+			ImageLinks:   make([]string, 0, len(report.Images)),
+			Likeint:      meta.Like,
+			Dislikeint:   meta.Dislike,
+			Time:         meta.Time,
+		},
+		Site:      meta.Site,
+		Board:     meta.Board,
+		Dir:       c.rel(report.Dir),
+		CrawledAt: meta.CrawledAt,
+	}
+	images := make([]CatalogImage, 0, len(report.Images))
+	for _, result := range report.Images {
+		post.ImageLinks = append(post.ImageLinks, result.URL)
+		images = append(images, CatalogImage{
+			URL:         result.URL,
+			Status:      result.Status,
+			Path:        c.rel(result.Path),
+			SHA256:      result.SHA256,
+			Width:       result.Width,
+			Height:      result.Height,
+			Size:        result.Size,
+			DuplicateOf: c.rel(result.DuplicateOf),
+		})
+	}
+	run := CrawlRun{
+		Site:     meta.Site,
+		Target:   report.Target,
+		Dir:      post.Dir,
+		Started:  report.Started,
+		Finished: report.Finished,
+		Done:     report.Count(ImageDone),
+		Skipped:  report.Count(ImageSkipped),
+		Failed:   report.Count(ImageFailed),
+		Pending:  report.Count(ImagePending),
+	}
+	if downloadErr != nil {
+		run.Error = downloadErr.Error()
+	}
+
+	return c.db.Update(func(tx *bolt.Tx) error {
+		if err := putJSON(tx.Bucket(catalogPostsBucket), []byte(post.URL), post); err != nil {
+			return err
+		}
+		if err := putImages(tx, post.URL, images); err != nil {
+			return err
+		}
+		return addRun(tx, &run)
+	})
+}
+
+// recordCatalog records a download into the catalog of base folder root.
+// Errors are logged, the images are saved anyway.
+func recordCatalog(root string, meta *PostMeta, report *DownloadReport, downloadErr error) {
+	c := catalogFor(root)
+	if c == nil {
+		return
+	}
+	if err := c.RecordDownload(meta, report, downloadErr); err != nil {
+		log.Printf("catalog error: %s, post: %s", err, meta.URL)
+	}
+}
+
+func putJSON(bucket *bolt.Bucket, key []byte, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(key, data)
+}
+
+// itob returns the big-endian bytes of v, so keys sort by number.
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
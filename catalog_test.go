@@ -0,0 +1,151 @@
+package photomgr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestCatalog_RecordDownload(t *testing.T) {
+	big := encodeTestImage(t, "jpg", 400, 400)
+	small := encodeTestImage(t, "png", 10, 10)
+
+	server := newCK101TestServer(t, map[string][]byte{"/big.jpg": big, "/small.png": small}, "/big.jpg", "/small.png", "/missing.jpg")
+
+	c := NewCK101()
+	c.BaseDir = t.TempDir()
+	target := server.URL + ck101TestThread
+	if _, err := c.Download(context.Background(), target, 2, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	catalog, err := OpenCatalog(c.BaseDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer catalog.Close()
+
+	post, err := catalog.Post(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if post.Site != "ck101" || post.ArticleID != "3000000" || post.ArticleTitle != "Album" ||
+		post.Dir != "CK101 - Album" || len(post.ImageLinks) != 3 || post.CrawledAt.IsZero() {
+		t.Errorf("Unexpected post: %+v", post)
+	}
+	if got := catalog.Path(post.Dir); got != filepath.Join(catalog.Root(), "CK101 - Album") {
+		t.Errorf("Unexpected album path %s", got)
+	}
+
+	images, err := catalog.Images(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 3 {
+		t.Fatalf("Expected 3 images, got %+v", images)
+	}
+	if images[0].Status != ImageDone || images[0].Path != "CK101 - Album/001.jpg" || images[0].Width != 400 ||
+		images[0].Height != 400 || images[0].Size != int64(len(big)) || images[0].SHA256 == "" {
+		t.Errorf("Unexpected saved image: %+v", images[0])
+	}
+	if images[1].Status != ImageSkipped || images[1].Width != 10 || images[0].Seq != 1 || images[2].Status != ImageFailed || images[2].Seq != 3 {
+		t.Errorf("Unexpected skipped and failed images: %+v", images[1:])
+	}
+	if same, err := catalog.ImagesByHash(images[0].SHA256); err != nil || len(same) != 1 || same[0].URL != images[0].URL {
+		t.Errorf("Expected the saved image by hash, got %+v, err %v", same, err)
+	}
+
+	// A second run replaces the post and images and adds a run.
+	if _, err := c.Download(context.Background(), target, 2, nil); err != nil {
+		t.Fatal(err)
+	}
+	runs, err := catalog.Runs(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 || runs[0].ID != 2 || runs[0].Target != target || runs[0].Done != 1 ||
+		runs[0].Skipped != 1 || runs[0].Failed != 1 || runs[0].Started.IsZero() {
+		t.Errorf("Unexpected runs: %+v", runs)
+	}
+	if images, _ := catalog.Images(target); len(images) != 3 {
+		t.Errorf("Expected 3 images after the second run, got %d", len(images))
+	}
+}
+
+func TestCatalog_Posts(t *testing.T) {
+	catalog, err := OpenCatalog(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer catalog.Close()
+
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, taiwanLocation)
+	posts := []CatalogPost{
+		{PostDoc: PostDoc{URL: "a", ArticleTitle: "[正妹] Sunny", Author: "alice", Likeint: 10, Time: base}, Site: "ptt", Board: "Beauty"},
+		{PostDoc: PostDoc{URL: "b", ArticleTitle: "[正妹] Rainy", Author: "bob", Likeint: 50, Time: base.Add(24 * time.Hour)}, Site: "ptt", Board: "Beauty"},
+		{PostDoc: PostDoc{URL: "c", ArticleTitle: "[閒聊] sunny day", Author: "Alice", Likeint: 99, Time: base.Add(48 * time.Hour)}, Site: "ptt", Board: "Gossiping"},
+		{PostDoc: PostDoc{URL: "d", ArticleTitle: "Sunny album"}, Site: "ck101"},
+	}
+	for _, post := range posts {
+		if err := catalog.PutPost(post); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		query    CatalogQuery
+		expected string
+	}{
+		{"all", CatalogQuery{}, "[c b a d]"},
+		{"board", CatalogQuery{Board: "beauty"}, "[b a]"},
+		{"author", CatalogQuery{Author: "ALICE"}, "[c a]"},
+		{"date range", CatalogQuery{From: base, To: base.Add(48 * time.Hour)}, "[b a]"},
+		{"pushes", CatalogQuery{MinPushes: 50}, "[c b]"},
+		{"keyword", CatalogQuery{Keyword: "sunny"}, "[c a d]"},
+		{"site and limit", CatalogQuery{Site: "ptt", Limit: 1}, "[c]"},
+	}
+	for _, tt := range tests {
+		found, err := catalog.Posts(tt.query)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var urls []string
+		for _, post := range found {
+			urls = append(urls, post.URL)
+		}
+		if got := fmt.Sprint(urls); got != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.expected, got)
+		}
+	}
+
+	if _, err := catalog.Post("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestCatalogFor_Locked(t *testing.T) {
+	root := t.TempDir()
+	// Another process holds the database.
+	db, err := bolt.Open(filepath.Join(root, CatalogFileName), 0644, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if c := catalogFor(root); c != nil {
+		t.Fatal("Expected no catalog while the database is locked")
+	}
+	start := time.Now()
+	if c := catalogFor(root); c != nil {
+		t.Fatal("Expected no catalog after a failed open")
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("Expected the failed open not tried again, took %v", elapsed)
+	}
+}
@@ -1,10 +1,13 @@
 package photomgr
 
 import (
+	"context"
 	"fmt"
 	"log"
-	"os"
-	"sync"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/PuerkitoBio/goquery"
 )
@@ -15,6 +18,17 @@ type CK101 struct {
 
 	//To store current CK101 post result
 	BaseDir string
+
+	// Naming builds the album folder and file names, nil means
+	// DefaultCK101NameTemplate.
+	Naming *NameTemplate
+
+	// Filter selects the saved images, nil means DefaultImageFilter.
+	Filter *ImageFilter
+}
+
+func init() {
+	RegisterSite("ck101", func() Site { return NewCK101() })
 }
 
 func NewCK101() *CK101 {
@@ -23,52 +37,91 @@ func NewCK101() *CK101 {
 	c.entryAddress = "https://ck101.com/forum-1345-1.html"
 	return c
 }
+
+// Name returns the registered site name.
+func (p *CK101) Name() string {
+	return "ck101"
+}
+
+// SetBaseDir sets the folder to store images.
+func (p *CK101) SetBaseDir(dir string) {
+	p.BaseDir = dir
+}
+
 func (b *CK101) HasValidURL(url string) bool {
 	log.Println("url=", url)
 	return true
 }
 
 func (p *CK101) Crawler(target string, workerNum int) {
+	if err := p.CrawlerContext(context.Background(), target, workerNum); err != nil {
+		log.Println("[CK101]: Crawler error:", err)
+	}
+}
 
-	doc, err := goquery.NewDocument(target)
+// CrawlerContext downloads all images of target post, it stops when ctx is done.
+func (p *CK101) CrawlerContext(ctx context.Context, target string, workerNum int) error {
+	_, err := p.Download(ctx, target, workerNum, nil)
+	return err
+}
+
+// Download downloads all images of target post like CrawlerContext, and
+// returns the result of every image. Events are sent to progress if not nil.
+func (p *CK101) Download(ctx context.Context, target string, workerNum int, progress ProgressFunc) (*DownloadReport, error) {
 	log.Println("Down load target URL=", target)
+	doc, err := fetchDocument(ctx, target)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	title := doc.Find("h1").Text()
-	log.Println("[CK101]:", title, " starting downloading...")
-	dir := fmt.Sprintf("%v/%v - %v", p.BaseDir, "CK101", title)
-	if exist, _ := exists(dir); exist {
-		return
+	if title == "" {
+		return nil, fmt.Errorf("%w: no title in %s", ErrParseFailed, target)
 	}
-	os.MkdirAll(dir, 0755)
-
-	linkChan := make(chan string)
-	wg := new(sync.WaitGroup)
-	for i := 0; i < workerNum; i++ {
-		wg.Add(1)
-		go p.worker(dir, linkChan, wg)
+	log.Println("[CK101]:", title, " starting downloading...")
+	meta := discuzPostMeta(doc, p.Name(), target, title)
+	naming := p.naming()
+	dir, err := makeAlbumDir(p.BaseDir, naming, meta)
+	if err != nil {
+		return nil, err
 	}
 
-	doc.Find("div[itemprop=articleBody] img").Each(func(i int, img *goquery.Selection) {
-		imgUrl, _ := img.Attr("file")
-		linkChan <- imgUrl
-	})
-
-	close(linkChan)
-	wg.Wait()
+	report := &DownloadReport{Target: target, Title: title, Dir: dir}
+	err = p.downloadImages(ctx, libraryFor(p.BaseDir), report, articleBodyImages(doc), downloadOptions{names: naming.fileNamer(nameVarsFromMeta(meta)), filter: p.Filter}, workerNum, progress)
+	writeAlbumMeta(report, meta)
+	recordCatalog(p.BaseDir, meta, report, err)
+	return report, err
 }
 
-//Set CK101 board page index, fetch all post and return article count back
+// Set CK101 board page index, fetch all post and return article count back
 func (p *CK101) ParseCK101PageByIndex(page int) int {
-	doc, err := goquery.NewDocument(p.entryAddress)
+	count, err := p.ParseCK101PageByIndexContext(context.Background(), page)
 	if err != nil {
-		log.Fatal(err)
+		log.Println("[CK101]: ParseCK101PageByIndex error:", err)
 	}
+	return count
+}
 
-	posts := make([]PostDoc, 0)
+// ParseCK101PageByIndexContext sets CK101 board page index, fetches all post
+// and returns article count back. Current result is cleared on error.
+func (p *CK101) ParseCK101PageByIndexContext(ctx context.Context, page int) (int, error) {
+	posts, err := p.ListPageContext(ctx, page)
+	count := p.setPosts(posts)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// ListPage returns the posts of board page by index, page 0 is the first
+// page. Unlike ParsePageByIndex it does not change the stored result, so it
+// can be used from many goroutines.
+func (p *CK101) ListPage(page int) ([]PostDoc, error) {
+	return p.ListPageContext(context.Background(), page)
+}
 
+// ListPageContext is the context-aware version of ListPage.
+func (p *CK101) ListPageContext(ctx context.Context, page int) ([]PostDoc, error) {
 	var PageWebSide string
 	page = page + 1 //one base
 	if page > 1 {
@@ -78,33 +131,182 @@ func (p *CK101) ParseCK101PageByIndex(page int) int {
 		PageWebSide = p.entryAddress
 	}
 
-	doc, err = goquery.NewDocument(PageWebSide)
+	doc, err := fetchDocument(ctx, PageWebSide)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+	return parseCK101List(doc, p.baseAddress), nil
+}
+
+var (
+	// ck101ThreadRegex captures the thread ID of "thread-3000000-1-1.html".
+	ck101ThreadRegex = regexp.MustCompile(`thread-(\d+)-`)
+	// ck101DateLayouts are the date formats shown in the CK101 thread list
+	// and thread pages.
+	ck101DateLayouts = []string{"2006-1-2 15:04:05", "2006-1-2 15:04", "2006-1-2"}
+)
+
+// parseDiscuzDate parses a date shown by a Discuz forum in Taiwan time, the
+// zero time if unknown.
+func parseDiscuzDate(date string) time.Time {
+	for _, layout := range ck101DateLayouts {
+		if t, err := time.ParseInLocation(layout, date, taiwanLocation); err == nil {
+			return t
+		}
 	}
+	return time.Time{}
+}
+
+// parseCK101List extracts posts from the `.cl_box` entries of a CK101 forum
+// page. The author and date come from the Discuz "cite" and "em" parts, the
+// date is taken from the span title when it is shown as relative time.
+func parseCK101List(doc *goquery.Document, baseAddress string) []PostDoc {
+	posts := make([]PostDoc, 0)
 	doc.Find(".cl_box").Each(func(i int, s *goquery.Selection) {
 		title := ""
 		url := ""
-		s.Find("a").Each(func(i int, tQ *goquery.Selection) {
+		s.Find("a[title]").Each(func(i int, tQ *goquery.Selection) {
 			title, _ = tQ.Attr("title")
 			goUrl, _ := tQ.Attr("href")
-			url = fmt.Sprintf("%s/%s", p.baseAddress, goUrl)
+			url = fmt.Sprintf("%s/%s", baseAddress, goUrl)
 		})
 
+		articleID := ""
+		if match := ck101ThreadRegex.FindStringSubmatch(url); match != nil {
+			articleID = match[1]
+		}
+
+		date := strings.TrimSpace(s.Find("em span[title]").AttrOr("title", ""))
+		if date == "" {
+			date = strings.TrimSpace(s.Find("em").First().Text())
+		}
+
 		newPost := PostDoc{
-			ArticleID:    "",
+			ArticleID:    articleID,
 			ArticleTitle: title,
+			Author:       strings.TrimSpace(s.Find("cite").First().Text()),
+			Date:         date,
 			URL:          url,
+			Time:         parseDiscuzDate(date),
 		}
 
 		posts = append(posts, newPost)
 	})
+	return posts
+}
 
-	p.storedPost = posts
-	return len(p.storedPost)
+// ParsePageByIndex fetches board page by index, page 0 is the first page.
+func (p *CK101) ParsePageByIndex(page int) int {
+	return p.ParseCK101PageByIndex(page)
+}
+
+// ParsePageByIndexContext is the context-aware version of ParsePageByIndex.
+func (p *CK101) ParsePageByIndexContext(ctx context.Context, page int) (int, error) {
+	return p.ParseCK101PageByIndexContext(ctx, page)
+}
+
+// ParseSearchByKeyword: CK101 does not support search, it always clears current result.
+func (p *CK101) ParseSearchByKeyword(keyword string) int {
+	count, err := p.ParseSearchByKeywordContext(context.Background(), keyword)
+	if err != nil {
+		log.Println("[CK101]: search error:", err)
+	}
+	return count
+}
+
+// ParseSearchByKeywordContext always returns ErrNotSupported.
+func (p *CK101) ParseSearchByKeywordContext(ctx context.Context, keyword string) (int, error) {
+	_, err := p.SearchContext(ctx, keyword)
+	return p.setPosts(nil), err
+}
+
+// Search is not supported by CK101, it always returns ErrNotSupported.
+func (p *CK101) Search(keyword string) ([]PostDoc, error) {
+	return p.SearchContext(context.Background(), keyword)
+}
+
+// SearchContext always returns ErrNotSupported.
+func (p *CK101) SearchContext(ctx context.Context, keyword string) ([]PostDoc, error) {
+	return nil, fmt.Errorf("%w: CK101 search, keyword=%s", ErrNotSupported, keyword)
+}
+
+// GetUrlTitle: return title of post
+func (p *CK101) GetUrlTitle(target string) string {
+	title, err := p.GetUrlTitleContext(context.Background(), target)
+	if err != nil {
+		log.Println(err)
+	}
+	return title
+}
+
+// GetUrlTitleContext returns title of post.
+func (p *CK101) GetUrlTitleContext(ctx context.Context, target string) (string, error) {
+	doc, err := fetchDocument(ctx, target)
+	if err != nil {
+		return "", err
+	}
+	title := doc.Find("h1").Text()
+	if title == "" {
+		return "", fmt.Errorf("%w: no title in %s", ErrParseFailed, target)
+	}
+	return title, nil
 }
 
 // GetAllImageAddress: return all image address in current page.
 func (p *CK101) GetAllImageAddress(target string) []string {
-	return nil
+	images, err := p.GetAllImageAddressContext(context.Background(), target)
+	if err != nil {
+		log.Println(err)
+	}
+	return images
+}
+
+// GetAllImageAddressContext returns all image address in target post.
+func (p *CK101) GetAllImageAddressContext(ctx context.Context, target string) ([]string, error) {
+	doc, err := fetchDocument(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	return articleBodyImages(doc), nil
+}
+
+// articleBodyImages returns the lazy-load image address of a Discuz forum post,
+// it is shared by CK101 and FBAlbum.
+func articleBodyImages(doc *goquery.Document) []string {
+	var links []string
+	doc.Find("div[itemprop=articleBody] img").Each(func(i int, img *goquery.Selection) {
+		if imgUrl, ok := img.Attr("file"); ok && imgUrl != "" {
+			links = append(links, imgUrl)
+		}
+	})
+	return links
+}
+
+// discuzThreadID returns the thread ID of a Discuz thread URL such as
+// "thread-3000000-1-1.html" or "viewthread.php?tid=3000000", or "".
+func discuzThreadID(target string) string {
+	if match := ck101ThreadRegex.FindStringSubmatch(target); match != nil {
+		return match[1]
+	}
+	if u, err := url.Parse(target); err == nil {
+		return u.Query().Get("tid")
+	}
+	return ""
+}
+
+// discuzPostMeta returns the provenance of a Discuz thread page, it is
+// shared by CK101 and FBAlbum. The author and date are the ones of the first
+// post, the date is taken from the span title when it is shown as relative
+// time.
+func discuzPostMeta(doc *goquery.Document, site string, target string, title string) *PostMeta {
+	meta := &PostMeta{Site: site, ArticleID: discuzThreadID(target), URL: target, Title: title}
+	meta.Author = strings.TrimSpace(doc.Find(".authi a.xw1").First().Text())
+
+	posted := doc.Find("em[id^=authorposton]").First()
+	meta.Date = strings.TrimSpace(posted.Find("span[title]").AttrOr("title", ""))
+	if meta.Date == "" {
+		meta.Date = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(posted.Text()), "發表於"))
+	}
+	meta.Time = parseDiscuzDate(meta.Date)
+	return meta
 }
@@ -0,0 +1,47 @@
+package photomgr
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const mockCK101ListHTML = `<html><body>
+<div class="cl_box">
+	<a href="thread-3001234-1-1.html" title="CK101 Post 1"><img src="cover1.jpg"></a>
+	<cite><a href="space-uid-1.html">ckuser1</a></cite>
+	<em><span title="2024-1-2 15:04">3 天前</span></em>
+</div>
+<div class="cl_box">
+	<a href="thread-3005678-1-1.html" title="CK101 Post 2"><img src="cover2.jpg"></a>
+	<cite>ckuser2</cite>
+	<em>2023-12-31</em>
+</div>
+</body></html>`
+
+func TestParseCK101List(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(mockCK101ListHTML))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	posts := parseCK101List(doc, "https://ck101.com")
+	expected := []PostDoc{
+		{ArticleID: "3001234", ArticleTitle: "CK101 Post 1", Author: "ckuser1", Date: "2024-1-2 15:04",
+			URL: "https://ck101.com/thread-3001234-1-1.html", Time: time.Date(2024, 1, 2, 15, 4, 0, 0, taiwanLocation)},
+		{ArticleID: "3005678", ArticleTitle: "CK101 Post 2", Author: "ckuser2", Date: "2023-12-31",
+			URL: "https://ck101.com/thread-3005678-1-1.html", Time: time.Date(2023, 12, 31, 0, 0, 0, 0, taiwanLocation)},
+	}
+	if len(posts) != len(expected) {
+		t.Fatalf("Expected %d posts, got %d", len(expected), len(posts))
+	}
+	for i := range expected {
+		if posts[i].ArticleID != expected[i].ArticleID || posts[i].ArticleTitle != expected[i].ArticleTitle ||
+			posts[i].Author != expected[i].Author || posts[i].Date != expected[i].Date ||
+			posts[i].URL != expected[i].URL || !posts[i].Time.Equal(expected[i].Time) {
+			t.Errorf("Post %d: expected %+v, got %+v", i, expected[i], posts[i])
+		}
+	}
+}
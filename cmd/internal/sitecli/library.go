@@ -0,0 +1,107 @@
+package sitecli
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kkdai/photomgr"
+)
+
+// newClustersCommand lists the near-duplicate clusters of the library in
+// baseDir, the highest resolution variant of each cluster is marked.
+func newClustersCommand(baseDir string) *cobra.Command {
+	var distance int
+	cmd := &cobra.Command{
+		Use:   "clusters",
+		Short: "List near-duplicate images in the download folder",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			lib, err := photomgr.OpenLibrary(baseDir)
+			if err != nil {
+				return err
+			}
+			clusters := lib.Clusters(distance)
+			for i, cluster := range clusters {
+				fmt.Printf("Cluster %d (%d images):\n", i+1, len(cluster))
+				for j, entry := range cluster {
+					mark := " "
+					if j == 0 {
+						mark = "*"
+					}
+					fmt.Printf(" %s %dx%d %dKB %s\n", mark, entry.Width, entry.Height, entry.Size/1024, entry.File)
+				}
+			}
+			fmt.Printf("%d clusters, * is the highest resolution variant\n", len(clusters))
+			return nil
+		},
+	}
+	cmd.Flags().IntVarP(&distance, "distance", "d", photomgr.DefaultSimilarDistance, "Max Hamming distance of perceptual hashes")
+	return cmd
+}
+
+// newSimilarCommand lists the images of the library in baseDir which are
+// similar to a given file.
+func newSimilarCommand(baseDir string) *cobra.Command {
+	var distance int
+	cmd := &cobra.Command{
+		Use:   "similar <image file>",
+		Short: "Find images similar to the given file in the download folder",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			lib, err := photomgr.OpenLibrary(baseDir)
+			if err != nil {
+				return err
+			}
+			similar, err := lib.SimilarToFile(args[0], distance)
+			if err != nil {
+				return err
+			}
+			for _, image := range similar {
+				fmt.Printf("[%2d] %dx%d %dKB %s\n", image.Distance, image.Width, image.Height, image.Size/1024, image.File)
+			}
+			fmt.Printf("%d similar images\n", len(similar))
+			return nil
+		},
+	}
+	cmd.Flags().IntVarP(&distance, "distance", "d", photomgr.DefaultSimilarDistance, "Max Hamming distance of perceptual hashes")
+	return cmd
+}
+
+// newImportCommand scans the album folders of baseDir into its library and
+// catalog. PTT albums without post.json are re-linked by searching their
+// title when site is PTT.
+func newImportCommand(site photomgr.Site, baseDir string) *cobra.Command {
+	var noRelink bool
+	cmd := &cobra.Command{
+		Use:   "import",
+		Short: "Import the existing album folders of the download folder",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var opts photomgr.ScanOptions
+			if ptt, ok := site.(*photomgr.PTT); ok && !noRelink {
+				opts.Relink = ptt
+			}
+			albums, err := photomgr.ImportAlbums(context.Background(), baseDir, opts)
+			linked, images := 0, 0
+			for _, album := range albums {
+				mark := " "
+				switch {
+				case album.Relinked:
+					mark = "+"
+				case album.URL() == "":
+					mark = "?"
+				}
+				if album.URL() != "" {
+					linked++
+				}
+				images += len(album.Images)
+				fmt.Printf(" %s %3d images %s\n", mark, len(album.Images), filepath.Base(album.Dir))
+			}
+			fmt.Printf("%d albums, %d images, %d linked to their post (+ re-linked, ? unknown post)\n", len(albums), images, linked)
+			return err
+		},
+	}
+	cmd.Flags().BoolVar(&noRelink, "no-relink", false, "Do not search the source post of albums without post.json")
+	return cmd
+}
@@ -0,0 +1,199 @@
+// Package sitecli implements the interactive shell shared by the site CLIs,
+// it only talks to photomgr.Site so every registered site works the same way.
+package sitecli
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/skratchdot/open-golang/open"
+	"github.com/spf13/cobra"
+
+	"github.com/kkdai/photomgr"
+)
+
+type NullWriter int
+
+func (NullWriter) Write([]byte) (int, error) { return 0, nil }
+
+func printPageResult(s photomgr.Site, count int) {
+	for i := 0; i < count; i++ {
+		title := s.GetPostTitleByIndex(i)
+		likeCount := s.GetPostStarByIndex(i)
+		fmt.Printf("%d:[%d★]%s\n", i, likeCount, title)
+	}
+	fmt.Printf("(o: open file in fider, s: search keyword, t: top page, n:next, p:prev, d: download, a: download all, quit: quit program)\n")
+}
+
+// NewCommand returns the root command of an interactive shell for site,
+// images are downloaded into baseDir.
+func NewCommand(site photomgr.Site, use string, baseDir string) *cobra.Command {
+	var workerNum int
+	rootCmd := &cobra.Command{
+		Use:   use,
+		Short: "Download all the images in given post url",
+		Run: func(cmd *cobra.Command, args []string) {
+			site.SetBaseDir(baseDir)
+			run(site, baseDir, workerNum)
+		},
+	}
+
+	rootCmd.Flags().IntVarP(&workerNum, "worker", "w", 25, "Number of workers")
+	rootCmd.AddCommand(newClustersCommand(baseDir), newSimilarCommand(baseDir), newImportCommand(site, baseDir))
+	return rootCmd
+}
+
+// download downloads the post at url with a progress bar, then prints the
+// summary, the skipped images with their reason and the failed images.
+func download(site photomgr.Site, url string, workerNum int) {
+	report, err := site.Download(context.Background(), url, workerNum, printProgress)
+	if report == nil {
+		fmt.Println("Download failed:", err)
+		return
+	}
+	fmt.Println("Done!", report.Summary())
+	for _, image := range report.Skips() {
+		fmt.Printf("  skipped %s: %s\n", image.URL, image.Skipped)
+	}
+	for _, image := range report.Failures() {
+		fmt.Printf("  failed %s: %v\n", image.URL, image.Err)
+	}
+	if err != nil {
+		fmt.Println("Download stopped:", err)
+	}
+}
+
+// downloadAll queues every post of the current page on a download manager
+// of workerNum workers, the posts with more pushes first, and prints each
+// summary.
+func downloadAll(site photomgr.Site, workerNum int) {
+	manager := photomgr.NewDownloadManager(workerNum)
+	defer manager.Close()
+
+	var posts []photomgr.PostDoc
+	for i := 0; i < site.GetCurrentPageResultCount(); i++ {
+		url := site.GetPostUrlByIndex(i)
+		if !site.HasValidURL(url) {
+			continue
+		}
+		posts = append(posts, photomgr.PostDoc{URL: url, Likeint: site.GetPostStarByIndex(i)})
+	}
+	downloads := manager.EnqueuePosts(context.Background(), site, posts, nil)
+	fmt.Printf("Downloading %d posts...\n", len(downloads))
+	for _, d := range downloads {
+		report, err := d.Wait()
+		if report == nil {
+			fmt.Printf("%s: %v\n", d.Target, err)
+			continue
+		}
+		fmt.Printf("%s: %s\n", report.Title, report.Summary())
+	}
+	fmt.Println("Done!")
+}
+
+func printProgress(event photomgr.DownloadEvent) {
+	const width = 30
+	done := width
+	if event.Total > 0 {
+		done = width * event.Completed / event.Total
+	}
+	fmt.Printf("\r[%s%s] %d/%d", strings.Repeat("#", done), strings.Repeat(" ", width-done), event.Completed, event.Total)
+	if event.Type == photomgr.DownloadFinished {
+		fmt.Println()
+	}
+}
+
+func run(site photomgr.Site, baseDir string, workerNum int) {
+	page := 0
+	pagePostCount := site.ParsePageByIndex(page)
+	printPageResult(site, pagePostCount)
+
+	scanner := bufio.NewScanner(os.Stdin)
+	quit := false
+
+	for !quit {
+		fmt.Printf("%s:> ", site.Name())
+
+		if !scanner.Scan() {
+			break
+		}
+
+		line := scanner.Text()
+		parts := strings.Split(line, " ")
+		cmd := parts[0]
+		args := parts[1:]
+
+		switch cmd {
+		case "quit":
+			quit = true
+		case "n":
+			page = page + 1
+			pagePostCount = site.ParsePageByIndex(page)
+			printPageResult(site, pagePostCount)
+		case "p":
+			if page > 0 {
+				page = page - 1
+			}
+			pagePostCount = site.ParsePageByIndex(page)
+			printPageResult(site, pagePostCount)
+		case "t":
+			page = 0
+			pagePostCount = site.ParsePageByIndex(page)
+			printPageResult(site, pagePostCount)
+		case "o":
+			open.Run(filepath.FromSlash(baseDir))
+		case "s":
+			if len(args) == 0 {
+				fmt.Println("You don't input any keyword. Input as 's keyword'")
+				continue
+			}
+
+			count, err := site.ParseSearchByKeywordContext(context.Background(), args[0])
+			switch {
+			case err != nil:
+				fmt.Println("Search failed:", err)
+			case count == 0:
+				fmt.Println("No posts found for", args[0])
+			default:
+				pagePostCount = count
+				printPageResult(site, pagePostCount)
+				continue
+			}
+			// The search cleared the listing, show the current page again.
+			pagePostCount = site.ParsePageByIndex(page)
+			printPageResult(site, pagePostCount)
+		case "d":
+			if len(args) == 0 {
+				fmt.Println("You don't input any article index. Input as 'd 1'")
+				continue
+			}
+
+			index, err := strconv.Atoi(args[0])
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+
+			if index < 0 || index >= site.GetCurrentPageResultCount() {
+				fmt.Println("Invalid index")
+				continue
+			}
+			url := site.GetPostUrlByIndex(index)
+
+			if site.HasValidURL(url) {
+				download(site, url, workerNum)
+			} else {
+				fmt.Println("Unsupport url:", url)
+			}
+		case "a":
+			downloadAll(site, workerNum)
+		default:
+			fmt.Println("Unrecognized command:", cmd, args)
+		}
+	}
+}
@@ -1,126 +1,38 @@
 package main
 
 import (
-	"bufio"
 	"fmt"
 	"log"
-	"os"
 	"os/user"
-	"path/filepath"
-	"strconv"
-	"strings"
 
-	"github.com/skratchdot/open-golang/open"
 	"github.com/spf13/cobra"
 
+	"github.com/kkdai/photomgr/cmd/internal/sitecli"
+
 	. "github.com/kkdai/photomgr"
 )
 
-func printPageResult(p *PTT, count int) {
-	for i := 0; i < count; i++ {
-		title := p.GetPostTitleByIndex(i)
-		likeCount := p.GetPostStarByIndex(i)
-		fmt.Printf("%d:[%d★]%s\n", i, likeCount, title)
-	}
-	fmt.Printf("(o: open file in fider, s: search keyword, t: top page, n:next, p:prev, quit: quit program)\n")
-}
-
-type NullWriter int
-
-func (NullWriter) Write([]byte) (int, error) { return 0, nil }
-
 func main() {
 
-	log.SetOutput(new(NullWriter))
+	log.SetOutput(new(sitecli.NullWriter))
 	ptt := NewPTT()
 
 	usr, _ := user.Current()
-	ptt.BaseDir = fmt.Sprintf("%v/Pictures/iloveptt", usr.HomeDir)
-
-	var workerNum int
-	rootCmd := &cobra.Command{
-		Use:   "iloveptt",
-		Short: "Download all the images in given post url",
-		Run: func(cmd *cobra.Command, args []string) {
-			page := 0
-			pagePostCount := 0
-			pagePostCount = ptt.ParsePttPageByIndex(page, true)
-			printPageResult(ptt, pagePostCount)
-
-			scanner := bufio.NewScanner(os.Stdin)
-			quit := false
-
-			for !quit {
-				fmt.Print("ptt:> ")
-
-				if !scanner.Scan() {
-					break
-				}
-
-				line := scanner.Text()
-				parts := strings.Split(line, " ")
-				cmd := parts[0]
-				args := parts[1:]
-
-				switch cmd {
-				case "quit":
-					quit = true
-				case "n":
-					page = page + 1
-					pagePostCount = ptt.ParsePttPageByIndex(page, true)
-					printPageResult(ptt, pagePostCount)
-				case "p":
-					if page > 0 {
-						page = page - 1
-					}
-					pagePostCount = ptt.ParsePttPageByIndex(page, true)
-					printPageResult(ptt, pagePostCount)
-				case "t":
-					page = 0
-					pagePostCount = ptt.ParsePttPageByIndex(page, true)
-					printPageResult(ptt, pagePostCount)
-				case "o":
-					open.Run(filepath.FromSlash(ptt.BaseDir))
-				case "s":
-					if len(args) == 0 {
-						fmt.Println("You don't input any article index. Input as 's keyword'")
-						continue
-					}
-
-					pagePostCount = ptt.ParseSearchByKeyword(args[0])
-					printPageResult(ptt, pagePostCount)
-				case "d":
-					if len(args) == 0 {
-						fmt.Println("You don't input any article index. Input as 'd 1'")
-						continue
-					}
-
-					index, err := strconv.Atoi(args[0])
-					if err != nil {
-						fmt.Println(err)
-						continue
-					}
-
-					url := ptt.GetPostUrlByIndex(index)
-
-					if int(index) >= len(url) {
-						fmt.Println("Invalid index")
-						continue
-					}
-
-					if ptt.HasValidURL(url) {
-						ptt.Crawler(url, 25)
-						fmt.Println("Done!")
-					} else {
-						fmt.Println("Unsupport url:", url)
-					}
-				default:
-					fmt.Println("Unrecognized command:", cmd, args)
-				}
-			}
-		},
+	baseDir := fmt.Sprintf("%v/Pictures/iloveptt", usr.HomeDir)
+
+	var board string
+	var categories []string
+	rootCmd := sitecli.NewCommand(ptt, "iloveptt", baseDir)
+	rootCmd.Flags().StringVarP(&board, "board", "b", "Beauty", "PTT board name, such as Gossiping")
+	rootCmd.Flags().StringSliceVarP(&categories, "category", "c", nil, "Only list posts of these categories, such as 正妹 (default: 正妹 on Beauty, all on other boards)")
+	rootCmd.PreRun = func(cmd *cobra.Command, args []string) {
+		if board != ptt.Board {
+			ptt.SetBoard(board)
+			ptt.TitleFilter = nil
+		}
+		if len(categories) > 0 {
+			ptt.TitleFilter = TitleCategoryFilter(categories...)
+		}
 	}
-
-	rootCmd.Flags().IntVarP(&workerNum, "worker", "w", 25, "Number of workers")
 	rootCmd.Execute()
 }
@@ -0,0 +1,255 @@
+package photomgr
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrManagerClosed is returned when downloading through a closed
+// DownloadManager.
+var ErrManagerClosed = errors.New("download manager is closed")
+
+// DefaultDownloadWorkers is the pool size of DefaultDownloadManager.
+const DefaultDownloadWorkers = 25
+
+// DefaultDownloadManager runs the image downloads of every Crawler,
+// CrawlerContext and Download call which is not queued on another manager.
+var DefaultDownloadManager = NewDownloadManager(DefaultDownloadWorkers)
+
+// DownloadManager is a long-lived pool of workers shared by the downloads of
+// many posts. The images of all posts wait in one queue, the images of the
+// post with the highest priority first, then in post order. The workerNum of
+// a single download only limits how many of its images are in flight at once.
+// The posts queued by Enqueue wait in a queue of their own, at most Workers
+// of them are fetched at once. It is safe for concurrent use.
+type DownloadManager struct {
+	workers int
+
+	start   sync.Once
+	mu      sync.Mutex
+	cond    *sync.Cond
+	queue   taskQueue
+	posts   taskQueue // Queued post downloads, see Enqueue
+	running int       // Started post downloads
+	seq     uint64
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+// NewDownloadManager returns a manager with a pool of workers goroutines,
+// which are started on the first download.
+func NewDownloadManager(workers int) *DownloadManager {
+	if workers < 1 {
+		workers = 1
+	}
+	m := &DownloadManager{workers: workers}
+	m.cond = sync.NewCond(&m.mu)
+	return m
+}
+
+// Workers returns the size of the pool.
+func (m *DownloadManager) Workers() int {
+	return m.workers
+}
+
+// Close stops the workers once the queued images are done, later downloads
+// fail with ErrManagerClosed.
+func (m *DownloadManager) Close() {
+	m.mu.Lock()
+	m.closed = true
+	m.mu.Unlock()
+	m.cond.Broadcast()
+	m.wg.Wait()
+}
+
+// PostDownload is a post queued by Enqueue.
+type PostDownload struct {
+	Target   string
+	Priority int
+
+	done   chan struct{}
+	report *DownloadReport
+	err    error
+}
+
+// Done is closed when the download of the post is finished.
+func (d *PostDownload) Done() <-chan struct{} {
+	return d.done
+}
+
+// Wait waits for the download of the post and returns its result, see
+// Site.Download.
+func (d *PostDownload) Wait() (*DownloadReport, error) {
+	<-d.done
+	return d.report, d.err
+}
+
+// Enqueue downloads the post target of site in the background, the post and
+// its images are queued with priority. Events are sent to progress if not
+// nil.
+func (m *DownloadManager) Enqueue(ctx context.Context, site Site, target string, priority int, progress ProgressFunc) *PostDownload {
+	d := &PostDownload{Target: target, Priority: priority, done: make(chan struct{})}
+	m.enqueue(ctx, site, []*PostDownload{d}, progress)
+	return d
+}
+
+// EnqueuePosts downloads many posts of site in the background, the posts
+// with more pushes (PostDoc.Likeint) first. The downloads are returned in the
+// order of posts.
+func (m *DownloadManager) EnqueuePosts(ctx context.Context, site Site, posts []PostDoc, progress ProgressFunc) []*PostDownload {
+	downloads := make([]*PostDownload, len(posts))
+	for i, post := range posts {
+		downloads[i] = &PostDownload{Target: post.URL, Priority: post.Likeint, done: make(chan struct{})}
+	}
+	m.enqueue(ctx, site, downloads, progress)
+	return downloads
+}
+
+// enqueue queues the downloads, all of them before any is started so the
+// highest priority is started first.
+func (m *DownloadManager) enqueue(ctx context.Context, site Site, downloads []*PostDownload, progress ProgressFunc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, d := range downloads {
+		d := d
+		ctx := context.WithValue(ctx, downloadContextKey{}, downloadContext{manager: m, priority: d.Priority})
+		m.seq++
+		heap.Push(&m.posts, &task{priority: d.Priority, seq: m.seq, run: func() {
+			defer close(d.done)
+			// Only the post page is fetched here, the images wait in the queue.
+			d.report, d.err = site.Download(ctx, d.Target, 0, progress)
+		}})
+	}
+	m.startPosts()
+}
+
+// startPosts starts the queued post downloads, the highest priority first,
+// while fewer than Workers are running. m.mu must be held.
+func (m *DownloadManager) startPosts() {
+	for m.running < m.workers && len(m.posts) > 0 {
+		t := heap.Pop(&m.posts).(*task)
+		m.running++
+		go func() {
+			t.run()
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			m.running--
+			m.startPosts()
+		}()
+	}
+}
+
+// downloadContextKey is the context key of the manager and priority of a
+// download started by Enqueue.
+type downloadContextKey struct{}
+
+type downloadContext struct {
+	manager  *DownloadManager
+	priority int
+}
+
+// downloadManagerFrom returns the manager and priority of the download of
+// ctx, DefaultDownloadManager and 0 when not queued by Enqueue.
+func downloadManagerFrom(ctx context.Context) (*DownloadManager, int) {
+	if dc, ok := ctx.Value(downloadContextKey{}).(downloadContext); ok {
+		return dc.manager, dc.priority
+	}
+	return DefaultDownloadManager, 0
+}
+
+// submit queues run with priority and returns its task, the workers are
+// started on first use.
+func (m *DownloadManager) submit(priority int, run func()) (*task, error) {
+	m.start.Do(func() {
+		m.wg.Add(m.workers)
+		for i := 0; i < m.workers; i++ {
+			go m.worker()
+		}
+	})
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil, ErrManagerClosed
+	}
+	m.seq++
+	t := &task{priority: priority, seq: m.seq, run: run}
+	heap.Push(&m.queue, t)
+	m.cond.Signal()
+	return t, nil
+}
+
+// cancel removes the tasks not started yet from the queue, they never run.
+// It returns how many were removed.
+func (m *DownloadManager) cancel(tasks []*task) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	removed := 0
+	for _, t := range tasks {
+		if t.index >= 0 {
+			heap.Remove(&m.queue, t.index)
+			removed++
+		}
+	}
+	return removed
+}
+
+func (m *DownloadManager) worker() {
+	defer m.wg.Done()
+	for {
+		m.mu.Lock()
+		for len(m.queue) == 0 && !m.closed {
+			m.cond.Wait()
+		}
+		if len(m.queue) == 0 {
+			m.mu.Unlock()
+			return
+		}
+		t := heap.Pop(&m.queue).(*task)
+		m.mu.Unlock()
+
+		t.run()
+	}
+}
+
+// task is a queued image download.
+type task struct {
+	priority int
+	seq      uint64 // Submit order, first in first out at the same priority
+	run      func()
+	index    int // Position in the queue, -1 once started or removed
+}
+
+// taskQueue is a heap of tasks, the highest priority first.
+type taskQueue []*task
+
+func (q taskQueue) Len() int { return len(q) }
+
+func (q taskQueue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q taskQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index, q[j].index = i, j
+}
+
+func (q *taskQueue) Push(x any) {
+	t := x.(*task)
+	t.index = len(*q)
+	*q = append(*q, t)
+}
+
+func (q *taskQueue) Pop() any {
+	old := *q
+	t := old[len(old)-1]
+	old[len(old)-1] = nil
+	t.index = -1
+	*q = old[:len(old)-1]
+	return t
+}
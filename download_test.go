@@ -0,0 +1,203 @@
+package photomgr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDownloadManager_Priority(t *testing.T) {
+	m := NewDownloadManager(1)
+	defer m.Close()
+
+	// Block the only worker so the next tasks wait in the queue.
+	block := make(chan struct{})
+	started := make(chan struct{})
+	m.submit(0, func() {
+		close(started)
+		<-block
+	})
+	<-started
+
+	var mu sync.Mutex
+	var order []string
+	wg := new(sync.WaitGroup)
+	for _, task := range []struct {
+		name     string
+		priority int
+	}{{"low-1", 1}, {"high-1", 10}, {"low-2", 1}, {"high-2", 10}, {"mid", 5}} {
+		task := task
+		wg.Add(1)
+		m.submit(task.priority, func() {
+			defer wg.Done()
+			mu.Lock()
+			order = append(order, task.name)
+			mu.Unlock()
+		})
+	}
+	close(block)
+	wg.Wait()
+
+	expected := []string{"high-1", "high-2", "mid", "low-1", "low-2"}
+	if fmt.Sprint(order) != fmt.Sprint(expected) {
+		t.Errorf("Expected order %v, got %v", expected, order)
+	}
+}
+
+func TestDownloadManager_Closed(t *testing.T) {
+	m := NewDownloadManager(2)
+	m.Close()
+	if _, err := m.submit(0, func() {}); !errors.Is(err, ErrManagerClosed) {
+		t.Errorf("Expected ErrManagerClosed, got %v", err)
+	}
+}
+
+func TestDownloadImages_CancelQueued(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(encodeTestImage(t, "jpg", 400, 400))
+	}))
+	defer server.Close()
+
+	m := NewDownloadManager(1)
+	defer m.Close()
+
+	// Higher priority work holds the only worker, so the images of the
+	// download stay queued.
+	block := make(chan struct{})
+	started := make(chan struct{})
+	m.submit(10, func() {
+		close(started)
+		select {
+		case <-block:
+		case <-time.After(5 * time.Second):
+		}
+	})
+	<-started
+	defer close(block)
+
+	ctx := context.WithValue(context.Background(), downloadContextKey{}, downloadContext{manager: m})
+	ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	images := []string{server.URL + "/a.jpg", server.URL + "/b.jpg", server.URL + "/c.jpg"}
+	report := &DownloadReport{Dir: t.TempDir()}
+
+	var b baseCrawler
+	start := time.Now()
+	err := b.downloadImages(ctx, nil, report, images, downloadOptions{}, 0, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the cancelled download to return at once, took %v", elapsed)
+	}
+	if report.Count(ImagePending) != len(images) {
+		t.Errorf("Expected the queued images pending, got %s", report.Summary())
+	}
+	m.mu.Lock()
+	queued := len(m.queue)
+	m.mu.Unlock()
+	if queued != 0 {
+		t.Errorf("Expected the queued images removed, %d left", queued)
+	}
+}
+
+func TestDownloadManager_EnqueuePosts(t *testing.T) {
+	big := encodeTestImage(t, "jpg", 400, 400)
+
+	var inFlight, maxInFlight int32
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var post int
+		if _, err := fmt.Sscanf(r.URL.Path, "/thread-%d-1-1.html", &post); err == nil {
+			fmt.Fprintf(w, `<html><body><h1>Post %d</h1><div itemprop="articleBody">`, post)
+			for i := 0; i < 4; i++ {
+				fmt.Fprintf(w, `<img file="%s/%d-%d.jpg">`, server.URL, post, i)
+			}
+			fmt.Fprint(w, `</div></body></html>`)
+			return
+		}
+
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		w.Write(big)
+	}))
+	defer server.Close()
+
+	m := NewDownloadManager(2)
+	defer m.Close()
+	c := NewCK101()
+	c.BaseDir = t.TempDir()
+
+	var posts []PostDoc
+	for i := 1; i <= 3; i++ {
+		posts = append(posts, PostDoc{URL: fmt.Sprintf("%s/thread-%d-1-1.html", server.URL, i), Likeint: i * 10})
+	}
+	downloads := m.EnqueuePosts(context.Background(), c, posts, nil)
+	if len(downloads) != 3 {
+		t.Fatalf("Expected 3 downloads, got %d", len(downloads))
+	}
+	for i, d := range downloads {
+		report, err := d.Wait()
+		if err != nil {
+			t.Fatalf("Post %d: %v", i+1, err)
+		}
+		if d.Priority != posts[i].Likeint || report.Title != fmt.Sprintf("Post %d", i+1) || report.Count(ImageDone) != 4 {
+			t.Errorf("Unexpected download of post %d: priority %d, %s, %s", i+1, d.Priority, report.Title, report.Summary())
+		}
+	}
+	if maxInFlight > 2 {
+		t.Errorf("Expected at most 2 images in flight, got %d", maxInFlight)
+	}
+}
+
+func TestDownloadManager_EnqueuePostsOrder(t *testing.T) {
+	var mu sync.Mutex
+	var order []int
+	var inFlight, maxInFlight int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		if n > atomic.LoadInt32(&maxInFlight) {
+			atomic.StoreInt32(&maxInFlight, n)
+		}
+		var post int
+		fmt.Sscanf(r.URL.Path, "/thread-%d-1-1.html", &post)
+		mu.Lock()
+		order = append(order, post)
+		mu.Unlock()
+		fmt.Fprintf(w, `<html><body><h1>Post %d</h1><div itemprop="articleBody"></div></body></html>`, post)
+	}))
+	defer server.Close()
+
+	m := NewDownloadManager(1)
+	defer m.Close()
+	c := NewCK101()
+	c.BaseDir = t.TempDir()
+
+	var posts []PostDoc
+	for i, pushes := range []int{10, 30, 20} {
+		posts = append(posts, PostDoc{URL: fmt.Sprintf("%s/thread-%d-1-1.html", server.URL, i+1), Likeint: pushes})
+	}
+	for _, d := range m.EnqueuePosts(context.Background(), c, posts, nil) {
+		if _, err := d.Wait(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// One post page at a time, the most pushed first.
+	if fmt.Sprint(order) != "[2 3 1]" || maxInFlight != 1 {
+		t.Errorf("Expected posts [2 3 1] one at a time, got %v with %d at once", order, maxInFlight)
+	}
+}
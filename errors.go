@@ -0,0 +1,33 @@
+package photomgr
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Errors returned by the context-aware API, check them with errors.Is.
+var (
+	// ErrNoFirecrawlKey is returned when a Firecrawl call is made without FIRECRAWL_KEY.
+	ErrNoFirecrawlKey = errors.New("FIRECRAWL_KEY not set")
+	// ErrNotFound is returned when the remote page or image does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrRateLimited is returned when the remote server answers 429 Too Many Requests.
+	ErrRateLimited = errors.New("rate limited")
+	// ErrParseFailed is returned when a page is fetched but nothing useful could be parsed.
+	ErrParseFailed = errors.New("parse failed")
+	// ErrNotSupported is returned when a site does not provide the requested feature.
+	ErrNotSupported = errors.New("not supported")
+)
+
+// statusError converts a non-200 response status into an error, wrapping
+// ErrNotFound or ErrRateLimited when the status matches.
+func statusError(target string, statusCode int) error {
+	switch statusCode {
+	case http.StatusNotFound, http.StatusGone:
+		return fmt.Errorf("%w: status %d for %s", ErrNotFound, statusCode, target)
+	case http.StatusTooManyRequests:
+		return fmt.Errorf("%w: status %d for %s", ErrRateLimited, statusCode, target)
+	}
+	return fmt.Errorf("unexpected status %d for %s", statusCode, target)
+}
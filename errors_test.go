@@ -0,0 +1,92 @@
+package photomgr
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCallFirecrawlAPIContext_NoKey(t *testing.T) {
+	t.Setenv("FIRECRAWL_KEY", "")
+	os.Unsetenv("FIRECRAWL_KEY")
+
+	_, err := callFirecrawlAPIContext(context.Background(), "http://example.com")
+	if !errors.Is(err, ErrNoFirecrawlKey) {
+		t.Errorf("expected ErrNoFirecrawlKey, got: %v", err)
+	}
+}
+
+func TestCallFirecrawlAPIContext_RateLimited(t *testing.T) {
+	t.Setenv("FIRECRAWL_KEY", "test_key")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+	originalURL := firecrawlScrapeURL
+	firecrawlScrapeURL = server.URL
+	t.Cleanup(func() { firecrawlScrapeURL = originalURL })
+
+	_, err := callFirecrawlAPIContext(context.Background(), "http://example.com")
+	if !errors.Is(err, ErrRateLimited) {
+		t.Errorf("expected ErrRateLimited, got: %v", err)
+	}
+}
+
+func TestFetchDocument_NotFound(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	_, err := fetchDocument(context.Background(), server.URL+"/bbs/Beauty/M.1.A.AAA.html", over18Cookie)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got: %v", err)
+	}
+}
+
+func TestCrawlerContext_ParseFailed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html><body>no title here</body></html>"))
+	}))
+	defer server.Close()
+
+	c := NewCK101()
+	c.BaseDir = t.TempDir()
+	err := c.CrawlerContext(context.Background(), server.URL, 2)
+	if !errors.Is(err, ErrParseFailed) {
+		t.Errorf("expected ErrParseFailed, got: %v", err)
+	}
+}
+
+func TestDownloadImages_Cancel(t *testing.T) {
+	block := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-block:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(block)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	images := make([]string, 10)
+	for i := range images {
+		images[i] = server.URL + "/image.jpg"
+	}
+
+	var b baseCrawler
+	start := time.Now()
+	err := b.downloadImages(ctx, nil, &DownloadReport{Dir: t.TempDir()}, images, downloadOptions{}, 2, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("downloadImages did not stop after cancel, took %v", elapsed)
+	}
+}
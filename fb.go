@@ -1,12 +1,11 @@
 package photomgr
 
 import (
+	"context"
 	"fmt"
 	"log"
-	"os"
 	"strconv"
 	"strings"
-	"sync"
 
 	"github.com/PuerkitoBio/goquery"
 )
@@ -17,6 +16,17 @@ type FBAlbum struct {
 
 	//To store current FBAlbum post result
 	BaseDir string
+
+	// Naming builds the album folder and file names, nil means
+	// DefaultFBAlbumNameTemplate.
+	Naming *NameTemplate
+
+	// Filter selects the saved images, nil means DefaultImageFilter.
+	Filter *ImageFilter
+}
+
+func init() {
+	RegisterSite("fbalbum", func() Site { return NewFBAlbum() })
 }
 
 func NewFBAlbum() *FBAlbum {
@@ -25,51 +35,91 @@ func NewFBAlbum() *FBAlbum {
 	c.entryAddress = "http://FBAlbum.com/forum-3465-1.html"
 	return c
 }
+
+// Name returns the registered site name.
+func (p *FBAlbum) Name() string {
+	return "fbalbum"
+}
+
+// SetBaseDir sets the folder to store images.
+func (p *FBAlbum) SetBaseDir(dir string) {
+	p.BaseDir = dir
+}
+
 func (b *FBAlbum) HasValidURL(url string) bool {
 	log.Println("url=", url)
 	return true
 }
 
 func (p *FBAlbum) Crawler(target string, workerNum int) {
+	if err := p.CrawlerContext(context.Background(), target, workerNum); err != nil {
+		log.Println("[FBAlbum]: Crawler error:", err)
+	}
+}
 
-	doc, err := goquery.NewDocument(target)
+// CrawlerContext downloads all images of target post, it stops when ctx is done.
+func (p *FBAlbum) CrawlerContext(ctx context.Context, target string, workerNum int) error {
+	_, err := p.Download(ctx, target, workerNum, nil)
+	return err
+}
+
+// Download downloads all images of target post like CrawlerContext, and
+// returns the result of every image. Events are sent to progress if not nil.
+func (p *FBAlbum) Download(ctx context.Context, target string, workerNum int, progress ProgressFunc) (*DownloadReport, error) {
+	doc, err := fetchDocument(ctx, target)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	title := doc.Find("h1#thread_subject").Text()
-
-	log.Println("[FBAlbum]:", title, " starting downloading...")
-	dir := fmt.Sprintf("%v/%v - %v", p.BaseDir, "FBAlbum", title)
-	if exist, _ := exists(dir); exist {
-		//fmt.Println("Already download")
-		return
+	if title == "" {
+		return nil, fmt.Errorf("%w: no title in %s", ErrParseFailed, target)
 	}
-	os.MkdirAll(dir, 0755)
 
-	linkChan := make(chan string)
-	wg := new(sync.WaitGroup)
-	for i := 0; i < workerNum; i++ {
-		wg.Add(1)
-		go p.worker(dir, linkChan, wg)
+	log.Println("[FBAlbum]:", title, " starting downloading...")
+	meta := discuzPostMeta(doc, p.Name(), target, title)
+	naming := p.naming()
+	dir, err := makeAlbumDir(p.BaseDir, naming, meta)
+	if err != nil {
+		return nil, err
 	}
 
-	doc.Find("div[itemprop=articleBody] img").Each(func(i int, img *goquery.Selection) {
-		imgUrl, _ := img.Attr("file")
-		linkChan <- imgUrl
-	})
-
-	close(linkChan)
-	wg.Wait()
+	report := &DownloadReport{Target: target, Title: title, Dir: dir}
+	err = p.downloadImages(ctx, libraryFor(p.BaseDir), report, articleBodyImages(doc), downloadOptions{names: naming.fileNamer(nameVarsFromMeta(meta)), filter: p.Filter}, workerNum, progress)
+	writeAlbumMeta(report, meta)
+	recordCatalog(p.BaseDir, meta, report, err)
+	return report, err
 }
 
-//Set FBAlbum board page index, fetch all post and return article count back
+// Set FBAlbum board page index, fetch all post and return article count back
 func (p *FBAlbum) ParseFBAlbumPageByIndex(page int) int {
-	doc, err := goquery.NewDocument(p.entryAddress)
+	count, err := p.ParseFBAlbumPageByIndexContext(context.Background(), page)
+	if err != nil {
+		log.Println("[FBAlbum]: ParseFBAlbumPageByIndex error:", err)
+	}
+	return count
+}
+
+// ParseFBAlbumPageByIndexContext sets FBAlbum board page index, fetches all
+// post and returns article count back. Current result is cleared on error.
+func (p *FBAlbum) ParseFBAlbumPageByIndexContext(ctx context.Context, page int) (int, error) {
+	posts, err := p.ListPageContext(ctx, page)
+	count := p.setPosts(posts)
 	if err != nil {
-		log.Fatal(err)
+		return 0, err
 	}
+	return count, nil
+}
 
+// ListPage returns the posts of board page by index, page 0 is the first
+// page. Unlike ParsePageByIndex it does not change the stored result, so it
+// can be used from many goroutines.
+func (p *FBAlbum) ListPage(page int) ([]PostDoc, error) {
+	return p.ListPageContext(context.Background(), page)
+}
+
+// ListPageContext is the context-aware version of ListPage.
+func (p *FBAlbum) ListPageContext(ctx context.Context, page int) ([]PostDoc, error) {
 	posts := make([]PostDoc, 0)
 
 	var PageWebSide string
@@ -82,9 +132,9 @@ func (p *FBAlbum) ParseFBAlbumPageByIndex(page int) int {
 	}
 	//fmt.Println("Page", PageWebSide)
 
-	doc, err = goquery.NewDocument(PageWebSide)
+	doc, err := fetchDocument(ctx, PageWebSide)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	doc.Find(".titleBox").Each(func(i int, s *goquery.Selection) {
 
@@ -114,11 +164,80 @@ func (p *FBAlbum) ParseFBAlbumPageByIndex(page int) int {
 		posts = append(posts, newPost)
 	})
 
-	p.storedPost = posts
-	return len(p.storedPost)
+	return posts, nil
+}
+
+// ParsePageByIndex fetches board page by index, page 0 is the first page.
+func (p *FBAlbum) ParsePageByIndex(page int) int {
+	return p.ParseFBAlbumPageByIndex(page)
+}
+
+// ParsePageByIndexContext is the context-aware version of ParsePageByIndex.
+func (p *FBAlbum) ParsePageByIndexContext(ctx context.Context, page int) (int, error) {
+	return p.ParseFBAlbumPageByIndexContext(ctx, page)
+}
+
+// ParseSearchByKeyword: FBAlbum does not support search, it always clears current result.
+func (p *FBAlbum) ParseSearchByKeyword(keyword string) int {
+	count, err := p.ParseSearchByKeywordContext(context.Background(), keyword)
+	if err != nil {
+		log.Println("[FBAlbum]: search error:", err)
+	}
+	return count
+}
+
+// ParseSearchByKeywordContext always returns ErrNotSupported.
+func (p *FBAlbum) ParseSearchByKeywordContext(ctx context.Context, keyword string) (int, error) {
+	_, err := p.SearchContext(ctx, keyword)
+	return p.setPosts(nil), err
+}
+
+// Search is not supported by FBAlbum, it always returns ErrNotSupported.
+func (p *FBAlbum) Search(keyword string) ([]PostDoc, error) {
+	return p.SearchContext(context.Background(), keyword)
+}
+
+// SearchContext always returns ErrNotSupported.
+func (p *FBAlbum) SearchContext(ctx context.Context, keyword string) ([]PostDoc, error) {
+	return nil, fmt.Errorf("%w: FBAlbum search, keyword=%s", ErrNotSupported, keyword)
+}
+
+// GetUrlTitle: return title of post
+func (p *FBAlbum) GetUrlTitle(target string) string {
+	title, err := p.GetUrlTitleContext(context.Background(), target)
+	if err != nil {
+		log.Println(err)
+	}
+	return title
+}
+
+// GetUrlTitleContext returns title of post.
+func (p *FBAlbum) GetUrlTitleContext(ctx context.Context, target string) (string, error) {
+	doc, err := fetchDocument(ctx, target)
+	if err != nil {
+		return "", err
+	}
+	title := doc.Find("h1#thread_subject").Text()
+	if title == "" {
+		return "", fmt.Errorf("%w: no title in %s", ErrParseFailed, target)
+	}
+	return title, nil
 }
 
 // GetAllImageAddress: return all image address in current page.
 func (p *FBAlbum) GetAllImageAddress(target string) []string {
-	return nil
+	images, err := p.GetAllImageAddressContext(context.Background(), target)
+	if err != nil {
+		log.Println(err)
+	}
+	return images
+}
+
+// GetAllImageAddressContext returns all image address in target post.
+func (p *FBAlbum) GetAllImageAddressContext(ctx context.Context, target string) ([]string, error) {
+	doc, err := fetchDocument(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	return articleBodyImages(doc), nil
 }
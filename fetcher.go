@@ -0,0 +1,300 @@
+package photomgr
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Fetcher fetches a page and returns its content as markdown, in the layout
+// parsed by parseMarkdownToPostDocs (index pages) and GetAllFromURL (articles).
+// Set PTT.Fetcher to change the provider.
+type Fetcher interface {
+	Fetch(ctx context.Context, targetURL string) (string, error)
+}
+
+// FirecrawlFetcher fetches pages through the Firecrawl scrape API, either the
+// Firecrawl cloud or a self-hosted instance.
+type FirecrawlFetcher struct {
+	// Endpoint is the scrape API address, empty means Firecrawl cloud.
+	Endpoint string
+	// APIKey is sent as bearer token, empty means the FIRECRAWL_KEY
+	// environment variable. It is only required by Firecrawl cloud.
+	APIKey string
+	// Client sends the requests, nil means DefaultHTTPClient.
+	Client *HTTPClient
+}
+
+// NewFirecrawlFetcher returns a fetcher for Firecrawl cloud, an empty apiKey
+// reads FIRECRAWL_KEY at fetch time.
+func NewFirecrawlFetcher(apiKey string) *FirecrawlFetcher {
+	return &FirecrawlFetcher{APIKey: apiKey}
+}
+
+// NewSelfHostedFirecrawlFetcher returns a fetcher for a self-hosted Firecrawl
+// running at baseURL (e.g. "http://localhost:3002"), apiKey may be empty.
+func NewSelfHostedFirecrawlFetcher(baseURL string, apiKey string) *FirecrawlFetcher {
+	return &FirecrawlFetcher{
+		Endpoint: strings.TrimRight(baseURL, "/") + "/v1/scrape",
+		APIKey:   apiKey,
+	}
+}
+
+// Fetch scrapes targetURL as markdown, see callFirecrawlAPI for the request
+// and response format. A missing key for Firecrawl cloud returns
+// ErrNoFirecrawlKey, and HTTP 404/429 are reported as ErrNotFound/ErrRateLimited.
+func (f *FirecrawlFetcher) Fetch(ctx context.Context, targetURL string) (string, error) {
+	endpoint := f.Endpoint
+	apiKey := f.APIKey
+	if apiKey == "" {
+		apiKey = os.Getenv("FIRECRAWL_KEY")
+	}
+	if endpoint == "" {
+		// Firecrawl cloud always needs a key.
+		endpoint = firecrawlScrapeURL
+		if apiKey == "" {
+			return "", ErrNoFirecrawlKey
+		}
+	}
+
+	requestBody := FirecrawlRequest{
+		URL: targetURL,
+		Headers: map[string]string{
+			"Cookie":     "over18=1",
+			"User-Agent": "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36",
+		},
+		Formats:         []string{"markdown", "links"},
+		OnlyMainContent: true,
+		WaitFor:         1000,
+	}
+
+	jsonBody, err := json.Marshal(requestBody)
+	if err != nil {
+		return "", fmt.Errorf("error marshalling request body: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return "", fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	client := f.Client
+	if client == nil {
+		client = DefaultHTTPClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error making request to Firecrawl API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := ioutil.ReadAll(resp.Body)
+		err := fmt.Errorf("Firecrawl API request failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+		switch resp.StatusCode {
+		case http.StatusNotFound:
+			return "", fmt.Errorf("%w: %v", ErrNotFound, err)
+		case http.StatusTooManyRequests:
+			return "", fmt.Errorf("%w: %v", ErrRateLimited, err)
+		}
+		return "", err
+	}
+
+	bodyBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("error reading response body: %w", err)
+	}
+
+	var firecrawlResp FirecrawlResponse
+	if err := json.Unmarshal(bodyBytes, &firecrawlResp); err != nil {
+		return "", fmt.Errorf("%w: error unmarshalling Firecrawl API response: %v. Response: %s", ErrParseFailed, err, string(bodyBytes))
+	}
+
+	if !firecrawlResp.Success {
+		if firecrawlResp.Error != nil {
+			return "", fmt.Errorf("Firecrawl API error (%d): %s", firecrawlResp.Error.Code, firecrawlResp.Error.Message)
+		}
+		return "", errors.New("Firecrawl API call was not successful, but no error message was provided")
+	}
+
+	if firecrawlResp.Data.Markdown == "" {
+		return "", fmt.Errorf("%w: Firecrawl API returned success but markdown content is empty", ErrParseFailed)
+	}
+
+	return appendLinks(firecrawlResp.Data.Markdown, firecrawlResp.Data.Links), nil
+}
+
+// appendLinks appends the page links reported by Firecrawl which are missing
+// from markdown (e.g. the paging buttons stripped by onlyMainContent), so the
+// newest index number can still be discovered.
+func appendLinks(markdown string, links []string) string {
+	var sb strings.Builder
+	for _, link := range links {
+		if !strings.Contains(markdown, link) {
+			fmt.Fprintf(&sb, "[](%s)\n", link)
+		}
+	}
+	if sb.Len() == 0 {
+		return markdown
+	}
+	return markdown + "\n\n" + sb.String()
+}
+
+// HTMLFetcher fetches pages directly with the over18 cookie and converts the
+// HTML to markdown without any external service. PTT index and article pages
+// are converted to the same layout Firecrawl returns, other pages to plain
+// text with image lines.
+type HTMLFetcher struct{}
+
+// Fetch gets targetURL and returns it as markdown.
+func (f *HTMLFetcher) Fetch(ctx context.Context, targetURL string) (string, error) {
+	doc, err := fetchDocument(ctx, targetURL, over18Cookie)
+	if err != nil {
+		return "", err
+	}
+	return htmlToMarkdown(doc, targetURL), nil
+}
+
+// htmlToMarkdown converts a fetched page to markdown, relative links are
+// resolved against pageURL.
+func htmlToMarkdown(doc *goquery.Document, pageURL string) string {
+	base, _ := url.Parse(pageURL)
+	abs := func(href string) string {
+		if base == nil {
+			return href
+		}
+		u, err := base.Parse(href)
+		if err != nil {
+			return href
+		}
+		return u.String()
+	}
+
+	var sb strings.Builder
+	switch {
+	case doc.Find(".r-ent").Length() > 0:
+		// PTT index or search result page.
+		doc.Find(".btn-group-paging a[href]").Each(func(i int, s *goquery.Selection) {
+			href, _ := s.Attr("href")
+			fmt.Fprintf(&sb, "[%s](%s)\n", strings.TrimSpace(s.Text()), abs(href))
+		})
+		doc.Find(".r-ent, .r-list-sep").EachWithBreak(func(i int, s *goquery.Selection) bool {
+			if s.HasClass("r-list-sep") {
+				return false
+			}
+			link := s.Find(".title a")
+			href, ok := link.Attr("href")
+			if !ok {
+				return true
+			}
+			fmt.Fprintf(&sb, "\n## %s\n[Read More](%s)\nAuthor: %s Date: %s Push: %s\n",
+				strings.TrimSpace(link.Text()), abs(href),
+				strings.TrimSpace(s.Find(".meta .author").Text()),
+				strings.TrimSpace(s.Find(".meta .date").Text()),
+				strings.TrimSpace(s.Find(".nrec").Text()))
+			return true
+		})
+
+	case doc.Find(".article-metaline").Length() > 0:
+		// PTT article page.
+		meta := map[string]string{}
+		doc.Find(".article-metaline, .article-metaline-right").Each(func(i int, s *goquery.Selection) {
+			meta[strings.TrimSpace(s.Find(".article-meta-tag").Text())] = strings.TrimSpace(s.Find(".article-meta-value").Text())
+		})
+		fmt.Fprintf(&sb, "**Author**: %s\n**Board**: %s\n**Title**: %s\n**Date**: %s\n\n",
+			meta["作者"], meta["看板"], meta["標題"], meta["時間"])
+
+		main := doc.Find("#main-content").Clone()
+		main.Find(".article-metaline, .article-metaline-right, .push").Remove()
+		for _, line := range strings.Split(strings.TrimSpace(main.Text()), "\n") {
+			if isImageLink(strings.TrimSpace(line)) {
+				line = "![](" + fixImgurLink(strings.TrimSpace(line)) + ")"
+			}
+			sb.WriteString(line + "\n")
+		}
+		doc.Find(".push").Each(func(i int, s *goquery.Selection) {
+			fmt.Fprintf(&sb, "%s %s%s %s\n",
+				strings.TrimSpace(s.Find(".push-tag").Text()),
+				strings.TrimSpace(s.Find(".push-userid").Text()),
+				strings.TrimRight(s.Find(".push-content").Text(), " "),
+				strings.TrimSpace(s.Find(".push-ipdatetime").Text()))
+		})
+
+	default:
+		sb.WriteString(strings.TrimSpace(doc.Find("body").Text()) + "\n")
+		doc.Find("img[src]").Each(func(i int, s *goquery.Selection) {
+			src, _ := s.Attr("src")
+			fmt.Fprintf(&sb, "![](%s)\n", abs(src))
+		})
+	}
+	return sb.String()
+}
+
+// FixtureFetcher replays recorded pages without any network access. Pages
+// are looked up in Pages first, then in Dir as written by RecordingFetcher.
+type FixtureFetcher struct {
+	Pages map[string]string
+	Dir   string
+}
+
+// Fetch returns the recorded markdown of targetURL, or ErrNotFound.
+func (f *FixtureFetcher) Fetch(ctx context.Context, targetURL string) (string, error) {
+	if markdown, ok := f.Pages[targetURL]; ok {
+		return markdown, nil
+	}
+	if f.Dir != "" {
+		data, err := os.ReadFile(filepath.Join(f.Dir, fixtureFileName(targetURL)))
+		if err == nil {
+			return string(data), nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("%w: no fixture for %s", ErrNotFound, targetURL)
+}
+
+// RecordingFetcher fetches pages with Fetcher and saves every result into
+// Dir, so they can be replayed later with FixtureFetcher.
+type RecordingFetcher struct {
+	Fetcher Fetcher
+	Dir     string
+}
+
+// Fetch fetches targetURL and records the markdown.
+func (f *RecordingFetcher) Fetch(ctx context.Context, targetURL string) (string, error) {
+	markdown, err := f.Fetcher.Fetch(ctx, targetURL)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(f.Dir, 0755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(f.Dir, fixtureFileName(targetURL)), []byte(markdown), 0644); err != nil {
+		return "", err
+	}
+	return markdown, nil
+}
+
+// fixtureFileName returns the file name a page is recorded as.
+func fixtureFileName(targetURL string) string {
+	sum := sha256.Sum256([]byte(targetURL))
+	return hex.EncodeToString(sum[:8]) + ".md"
+}
@@ -0,0 +1,110 @@
+package photomgr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestFixtureFetcher_PTT(t *testing.T) {
+	ptt := NewPTT()
+	ptt.Fetcher = &FixtureFetcher{Pages: map[string]string{
+		ptt.entryAddress: mockIndexMarkdownPage1,
+		ptt.baseAddress + "/bbs/Beauty/index2.html": mockIndexMarkdownPage2,
+	}}
+
+	if count := ptt.ParsePttPageByIndex(0, true); count != 2 {
+		t.Fatalf("Expected 2 posts from fixture page, got %d", count)
+	}
+	if count := ptt.ParsePttPageByIndex(2, false); count != 3 {
+		t.Fatalf("Expected 3 posts after appending fixture page 2, got %d", count)
+	}
+
+	// No fixture and no fallback: the error is returned as is.
+	ptt.Backend = PttBackendFirecrawl
+	_, err := ptt.ParsePttPageByIndexContext(context.Background(), 99, true)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for missing fixture, got: %v", err)
+	}
+}
+
+func TestSelfHostedFirecrawlFetcher(t *testing.T) {
+	t.Setenv("FIRECRAWL_KEY", "")
+	os.Unsetenv("FIRECRAWL_KEY")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/scrape" {
+			t.Errorf("Expected path '/v1/scrape', got '%s'", r.URL.Path)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			t.Errorf("Expected no Authorization header without key, got '%s'", auth)
+		}
+		json.NewEncoder(w).Encode(FirecrawlResponse{Success: true, Data: FirecrawlResponseData{Markdown: "## Self Hosted"}})
+	}))
+	defer server.Close()
+
+	markdown, err := NewSelfHostedFirecrawlFetcher(server.URL+"/", "").Fetch(context.Background(), "https://www.ptt.cc/bbs/Beauty/index.html")
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if markdown != "## Self Hosted" {
+		t.Errorf("Unexpected markdown: %q", markdown)
+	}
+
+	if _, err := NewFirecrawlFetcher("").Fetch(context.Background(), "http://example.com"); !errors.Is(err, ErrNoFirecrawlKey) {
+		t.Errorf("expected ErrNoFirecrawlKey for Firecrawl cloud, got: %v", err)
+	}
+}
+
+func TestHTMLFetcher_Markdown(t *testing.T) {
+	server := newHTMLTestServer(t)
+	fetcher := &HTMLFetcher{}
+
+	markdown, err := fetcher.Fetch(context.Background(), server.URL+"/bbs/Beauty/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	posts := parseMarkdownToPostDocs(markdown, server.URL)
+	if len(posts) != 3 {
+		t.Fatalf("Expected 3 posts from converted markdown, got %d:\n%s", len(posts), markdown)
+	}
+	if posts[1].URL != server.URL+"/bbs/Beauty/M.1704153600.A.BBB.html" || posts[1].Likeint != 100 {
+		t.Errorf("Unexpected post from converted markdown: %+v", posts[1])
+	}
+
+	markdown, err = fetcher.Fetch(context.Background(), server.URL+"/bbs/Beauty/M.1704067200.A.AAA.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	article := parseArticleMarkdown(markdown, "dummy")
+	if article.Title != "[正妹] HTML Article" || article.Author != "htmluser" {
+		t.Errorf("Unexpected article meta from converted markdown: %+v", article)
+	}
+	if len(article.ImageURLs) != 2 || article.Content != "This is the HTML content." {
+		t.Errorf("Unexpected article body from converted markdown: images=%v content=%q", article.ImageURLs, article.Content)
+	}
+}
+
+func TestRecordingFetcher_Replay(t *testing.T) {
+	dir := t.TempDir()
+	target := "https://www.ptt.cc/bbs/Beauty/index.html"
+
+	recorder := &RecordingFetcher{
+		Fetcher: &FixtureFetcher{Pages: map[string]string{target: mockIndexMarkdownPage2}},
+		Dir:     dir,
+	}
+	if _, err := recorder.Fetch(context.Background(), target); err != nil {
+		t.Fatal(err)
+	}
+
+	markdown, err := (&FixtureFetcher{Dir: dir}).Fetch(context.Background(), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if markdown != mockIndexMarkdownPage2 {
+		t.Errorf("Replayed markdown does not match the recorded one: %q", markdown)
+	}
+}
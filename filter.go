@@ -0,0 +1,136 @@
+package photomgr
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// ImageFilter selects the images saved by a download, the other ones are
+// skipped with their reason in the DownloadReport and the manifest. Zero
+// fields do not filter.
+type ImageFilter struct {
+	// MinWidth and MinHeight are the smallest dimensions kept, MaxWidth and
+	// MaxHeight the largest.
+	MinWidth  int `json:"min_width,omitempty"`
+	MinHeight int `json:"min_height,omitempty"`
+	MaxWidth  int `json:"max_width,omitempty"`
+	MaxHeight int `json:"max_height,omitempty"`
+	// MinBytes and MaxBytes bound the file size. Larger files are skipped
+	// without reading them all.
+	MinBytes int64 `json:"min_bytes,omitempty"`
+	MaxBytes int64 `json:"max_bytes,omitempty"`
+	// Formats are the kept content formats, as the file extensions "jpg",
+	// "png", "gif", "webp" and "bmp". Empty keeps all of them.
+	Formats []string `json:"formats,omitempty"`
+	// MinAspect and MaxAspect bound the width / height ratio, such as 0.5
+	// for portraits twice as high as wide.
+	MinAspect float64 `json:"min_aspect,omitempty"`
+	MaxAspect float64 `json:"max_aspect,omitempty"`
+	// SkipImgurRemoved skips the placeholder image imgur serves for removed
+	// images.
+	SkipImgurRemoved bool `json:"skip_imgur_removed,omitempty"`
+}
+
+// DefaultImageFilter is the filter of the sites without their own: images
+// larger than 300x300 and not removed from imgur, as in earlier versions.
+var DefaultImageFilter = ImageFilter{MinWidth: 301, MinHeight: 301, SkipImgurRemoved: true}
+
+// Dimensions of the removed image placeholder of imgur, served at
+// i.imgur.com/removed.png or in place of the removed image.
+const (
+	imgurRemovedWidth  = 161
+	imgurRemovedHeight = 81
+)
+
+// orDefault returns f, or DefaultImageFilter if nil.
+func (f *ImageFilter) orDefault() *ImageFilter {
+	if f == nil {
+		return &DefaultImageFilter
+	}
+	return f
+}
+
+// equal reports whether f and o keep the same images.
+func (f *ImageFilter) equal(o *ImageFilter) bool {
+	return f.MinWidth == o.MinWidth && f.MinHeight == o.MinHeight &&
+		f.MaxWidth == o.MaxWidth && f.MaxHeight == o.MaxHeight &&
+		f.MinBytes == o.MinBytes && f.MaxBytes == o.MaxBytes &&
+		slices.Equal(f.Formats, o.Formats) &&
+		f.MinAspect == o.MinAspect && f.MaxAspect == o.MaxAspect &&
+		f.SkipImgurRemoved == o.SkipImgurRemoved
+}
+
+// checkURL returns the skip reason of the image served at final after
+// redirects, or "" to go on.
+func (f *ImageFilter) checkURL(final *url.URL) string {
+	if f.SkipImgurRemoved && final != nil && isImgurHost(final.Hostname()) && final.Path == "/removed.png" {
+		return "imgur removed placeholder"
+	}
+	return ""
+}
+
+// checkLength returns the skip reason of an image of length bytes, as
+// announced before the download, or "" to go on. A negative length is
+// unknown.
+func (f *ImageFilter) checkLength(length int64) string {
+	if f.MaxBytes > 0 && length > f.MaxBytes {
+		return fmt.Sprintf("file too large: %d bytes", length)
+	}
+	return ""
+}
+
+// checkHeader returns the skip reason of an image of target from its format
+// and dimensions, or "" to go on.
+func (f *ImageFilter) checkHeader(target string, format string, width int, height int) string {
+	if len(f.Formats) > 0 && !hasFormat(f.Formats, format) {
+		return fmt.Sprintf("format %s not allowed", format)
+	}
+	if f.SkipImgurRemoved && format == "png" && width == imgurRemovedWidth && height == imgurRemovedHeight {
+		if u, err := url.Parse(target); err == nil && isImgurHost(u.Hostname()) {
+			return "imgur removed placeholder"
+		}
+	}
+	if width < f.MinWidth || height < f.MinHeight {
+		return fmt.Sprintf("too small: %dx%d", width, height)
+	}
+	if (f.MaxWidth > 0 && width > f.MaxWidth) || (f.MaxHeight > 0 && height > f.MaxHeight) {
+		return fmt.Sprintf("too large: %dx%d", width, height)
+	}
+	if (f.MinAspect > 0 || f.MaxAspect > 0) && height > 0 {
+		aspect := float64(width) / float64(height)
+		if (f.MinAspect > 0 && aspect < f.MinAspect) || (f.MaxAspect > 0 && aspect > f.MaxAspect) {
+			return fmt.Sprintf("aspect ratio %.2f out of range", aspect)
+		}
+	}
+	return ""
+}
+
+// checkSize returns the skip reason of a downloaded image of size bytes, or
+// "" to keep it.
+func (f *ImageFilter) checkSize(size int64) string {
+	if f.MinBytes > 0 && size < f.MinBytes {
+		return fmt.Sprintf("file too small: %d bytes", size)
+	}
+	return ""
+}
+
+func isImgurHost(host string) bool {
+	return host == "imgur.com" || strings.HasSuffix(host, ".imgur.com")
+}
+
+// hasFormat reports whether the format list has format, case and leading
+// dot ignored and "jpeg" the same as "jpg".
+func hasFormat(list []string, format string) bool {
+	for _, v := range list {
+		v = strings.TrimPrefix(v, ".")
+		if strings.EqualFold(v, "jpeg") {
+			v = "jpg"
+		}
+		if strings.EqualFold(v, format) {
+			return true
+		}
+	}
+	return false
+}
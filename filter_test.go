@@ -0,0 +1,162 @@
+package photomgr
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestImageFilter_Check(t *testing.T) {
+	filter := ImageFilter{MinWidth: 100, MinHeight: 100, MaxWidth: 4000, MaxHeight: 4000,
+		Formats: []string{".JPEG", "png"}, MinAspect: 0.5, MaxAspect: 2, SkipImgurRemoved: true}
+
+	tests := []struct {
+		target        string
+		format        string
+		width, height int
+		expected      string
+	}{
+		{"https://example.com/a.jpg", "jpg", 800, 600, ""},
+		{"https://example.com/a.gif", "gif", 800, 600, "format gif not allowed"},
+		{"https://example.com/a.png", "png", 99, 600, "too small: 99x600"},
+		{"https://example.com/a.png", "png", 5000, 4000, "too large: 5000x4000"},
+		{"https://example.com/a.png", "png", 1000, 200, "aspect ratio 5.00 out of range"},
+		{"https://example.com/a.png", "png", 200, 1000, "aspect ratio 0.20 out of range"},
+		{"https://i.imgur.com/abc.png", "png", 161, 81, "imgur removed placeholder"},
+		// The same size elsewhere is a small image.
+		{"https://example.com/abc.png", "png", 161, 81, "too small: 161x81"},
+	}
+	for _, tt := range tests {
+		if got := filter.checkHeader(tt.target, tt.format, tt.width, tt.height); got != tt.expected {
+			t.Errorf("checkHeader(%s, %dx%d): expected %q, got %q", tt.format, tt.width, tt.height, tt.expected, got)
+		}
+	}
+
+	removed, _ := url.Parse("https://i.imgur.com/removed.png")
+	if got := filter.checkURL(removed); got != "imgur removed placeholder" {
+		t.Errorf("Expected the imgur removed redirect skipped, got %q", got)
+	}
+	if got := (&ImageFilter{}).checkURL(removed); got != "" {
+		t.Errorf("Expected no skip without SkipImgurRemoved, got %q", got)
+	}
+
+	bytes := ImageFilter{MinBytes: 100, MaxBytes: 1000}
+	if bytes.checkSize(99) != "file too small: 99 bytes" || bytes.checkLength(1001) != "file too large: 1001 bytes" ||
+		bytes.checkLength(-1) != "" || bytes.checkSize(1000) != "" {
+		t.Error("Unexpected byte size checks")
+	}
+
+	// The default keeps images larger than 300x300.
+	if got := DefaultImageFilter.checkHeader("https://example.com/a.gif", "gif", 300, 1000); got != "too small: 300x1000" {
+		t.Errorf("Expected the default filter to skip 300x1000, got %q", got)
+	}
+}
+
+func TestDownload_ImageFilter(t *testing.T) {
+	images := map[string][]byte{
+		"/a.jpg":   encodeTestImage(t, "jpg", 400, 400),
+		"/b.png":   encodeTestImage(t, "png", 400, 400),
+		"/c.jpg":   encodeTestImage(t, "jpg", 1000, 200),
+		"/d.jpg":   encodeTestImage(t, "jpg", 200, 200),
+		"/big.jpg": encodeTestImage(t, "jpg", 2000, 2000),
+	}
+	server := newCK101TestServer(t, images, "/a.jpg", "/b.png", "/c.jpg", "/d.jpg", "/big.jpg")
+
+	c := NewCK101()
+	c.BaseDir = t.TempDir()
+	c.Filter = &ImageFilter{MinWidth: 100, MinHeight: 100, Formats: []string{"jpg"}, MaxAspect: 2,
+		MaxBytes: int64(len(images["/big.jpg"])) - 1}
+	report, err := c.Download(context.Background(), server.URL+ck101TestThread, 2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, image := range report.Images {
+		got = append(got, image.Status+" "+image.Skipped)
+	}
+	expected := []string{
+		"done ",
+		"skipped format png not allowed",
+		"skipped aspect ratio 5.00 out of range",
+		"done ",
+		"skipped file too large",
+	}
+	for i := range expected {
+		if i >= len(got) || !strings.HasPrefix(got[i], expected[i]) {
+			t.Fatalf("Expected %q, got %q", expected, got)
+		}
+	}
+	if len(report.Skips()) != 3 {
+		t.Errorf("Expected 3 skipped images, got %d", len(report.Skips()))
+	}
+
+	// The reasons are kept in the manifest.
+	manifest, err := LoadManifest(report.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry, _ := manifest.Entry(server.URL + "/b.png"); entry.Error != "format png not allowed" {
+		t.Errorf("Expected the skip reason in the manifest, got %+v", entry)
+	}
+}
+
+func TestDownload_ImageFilterChanged(t *testing.T) {
+	requests := map[string]int{}
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/thread-3000000-1-1.html" {
+			fmt.Fprintf(w, `<html><body><h1>Album</h1><div itemprop="articleBody">
+				<img file="%[1]s/a.jpg"><img file="%[1]s/b.jpg">
+			</div></body></html>`, server.URL)
+			return
+		}
+		requests[r.URL.Path]++
+		if r.URL.Path == "/a.jpg" {
+			w.Write(encodeTestImage(t, "jpg", 400, 400))
+			return
+		}
+		w.Write(encodeTestImage(t, "jpg", 200, 200))
+	}))
+	defer server.Close()
+
+	c := NewCK101()
+	c.BaseDir = t.TempDir()
+	target := server.URL + "/thread-3000000-1-1.html"
+	report, err := c.Download(context.Background(), target, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Images[1].Status != ImageSkipped {
+		t.Fatalf("Expected the small image skipped by the default filter, got %+v", report.Images[1])
+	}
+
+	// The same filter does not download the skipped image again.
+	if _, err := c.Download(context.Background(), target, 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if requests["/b.jpg"] != 1 {
+		t.Errorf("Expected 1 request for the skipped image, got %d", requests["/b.jpg"])
+	}
+
+	// A lower MinWidth keeps it.
+	c.Filter = &ImageFilter{MinWidth: 100, MinHeight: 100}
+	report, err = c.Download(context.Background(), target, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Images[1].Status != ImageDone || !report.Images[0].Resumed || requests["/a.jpg"] != 1 {
+		t.Errorf("Expected only the skipped image downloaded again, got %+v, requests %v", report.Images, requests)
+	}
+	manifest, err := LoadManifest(report.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Filter == nil || manifest.Filter.MinWidth != 100 {
+		t.Errorf("Expected the filter in the manifest, got %+v", manifest.Filter)
+	}
+}
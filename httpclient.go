@@ -0,0 +1,235 @@
+package photomgr
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimit is a token bucket: PerSecond requests on average, and up to Burst
+// requests at once. A zero PerSecond means no limit.
+type RateLimit struct {
+	PerSecond float64
+	Burst     int
+}
+
+// HTTPClient is the HTTP layer shared by every site crawler and the Firecrawl
+// client. It adds to http.Client a retry with jittered exponential backoff,
+// which honors Retry-After, and a token bucket rate limit per host.
+//
+// The fields must not be changed once the client is in use.
+type HTTPClient struct {
+	// Client sends the requests, its Timeout bounds every attempt.
+	Client *http.Client
+
+	// MaxRetries is the number of retries after network errors, HTTP 429 and
+	// HTTP 5xx responses. The last response or error is returned as is.
+	MaxRetries int
+	// BaseDelay is the backoff of the first retry, doubled on every retry up
+	// to MaxDelay. A Retry-After longer than MaxDelay is not waited for.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+
+	// DefaultLimit applies to every host without an entry in HostLimits.
+	DefaultLimit RateLimit
+	// HostLimits are the rate limits by host name, such as "i.imgur.com".
+	HostLimits map[string]RateLimit
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// NewHTTPClient returns an HTTPClient with the default timeout, retries and
+// rate limits. Imgur gets a lower limit as it answers bursts with HTTP 429.
+func NewHTTPClient() *HTTPClient {
+	return &HTTPClient{
+		Client:       &http.Client{Timeout: 60 * time.Second},
+		MaxRetries:   3,
+		BaseDelay:    time.Second,
+		MaxDelay:     30 * time.Second,
+		DefaultLimit: RateLimit{PerSecond: 5, Burst: 5},
+		HostLimits: map[string]RateLimit{
+			"imgur.com":   {PerSecond: 2, Burst: 4},
+			"i.imgur.com": {PerSecond: 2, Burst: 4},
+		},
+	}
+}
+
+// DefaultHTTPClient is used for every request of the package. Replace or
+// configure it before starting any crawler.
+var DefaultHTTPClient = NewHTTPClient()
+
+// Do sends req, waiting for the rate limit of its host before every attempt,
+// and retries on failure as configured. The request body is replayed with
+// req.GetBody, which http.NewRequest sets for in-memory bodies.
+func (c *HTTPClient) Do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	for attempt := 0; ; attempt++ {
+		if err := c.bucket(req.URL.Hostname()).wait(ctx); err != nil {
+			return nil, err
+		}
+
+		r := req
+		if attempt > 0 {
+			r = req.Clone(ctx)
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				r.Body = body
+			}
+		}
+
+		resp, err := client.Do(r)
+		if attempt >= c.MaxRetries || ctx.Err() != nil || (err == nil && !retryable(resp.StatusCode)) {
+			return resp, err
+		}
+		if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+			// The body can not be sent again.
+			return resp, err
+		}
+
+		delay := c.backoff(attempt)
+		if err == nil {
+			if after, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+				if after > c.MaxDelay {
+					return resp, nil
+				}
+				delay = after
+			}
+			// Drain the body so the connection can be reused.
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// retryable reports whether a response with status code is worth a retry.
+func retryable(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// backoff returns the jittered delay before retry attempt+1: a random value
+// between half and all of BaseDelay * 2^attempt, capped at MaxDelay.
+func (c *HTTPClient) backoff(attempt int) time.Duration {
+	d := c.BaseDelay << uint(attempt)
+	if d > c.MaxDelay || d <= 0 {
+		d = c.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retryAfter parses a Retry-After header, in seconds or as an HTTP date.
+func retryAfter(value string) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if sec, err := strconv.Atoi(value); err == nil && sec >= 0 {
+		return time.Duration(sec) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+// bucket returns the token bucket of host, created on first use.
+func (c *HTTPClient) bucket(host string) *tokenBucket {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if b, ok := c.buckets[host]; ok {
+		return b
+	}
+	limit, ok := c.HostLimits[host]
+	if !ok {
+		limit = c.DefaultLimit
+	}
+	if c.buckets == nil {
+		c.buckets = make(map[string]*tokenBucket)
+	}
+	b := newTokenBucket(limit)
+	c.buckets[host] = b
+	return b
+}
+
+// tokenBucket hands out one token per request, refilled at limit.PerSecond.
+type tokenBucket struct {
+	limit  RateLimit
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit RateLimit) *tokenBucket {
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+	return &tokenBucket{limit: limit, tokens: float64(limit.Burst), last: time.Now()}
+}
+
+// wait takes a token, sleeping until one is available or ctx is done.
+func (b *tokenBucket) wait(ctx context.Context) error {
+	if b.limit.PerSecond <= 0 {
+		return ctx.Err()
+	}
+
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.limit.PerSecond
+	if max := float64(b.limit.Burst); b.tokens > max {
+		b.tokens = max
+	}
+	b.last = now
+	// Reserve the token now, possibly going negative, so waiters are served
+	// in order.
+	b.tokens--
+	var delay time.Duration
+	if b.tokens < 0 {
+		delay = time.Duration(-b.tokens / b.limit.PerSecond * float64(time.Second))
+	}
+	b.mu.Unlock()
+
+	if delay == 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// Give the reserved token back.
+		b.mu.Lock()
+		b.tokens++
+		b.mu.Unlock()
+		return ctx.Err()
+	}
+}
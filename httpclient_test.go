@@ -0,0 +1,220 @@
+package photomgr
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// Keep the retries of the mock servers fast, and do not rate limit them.
+	DefaultHTTPClient.BaseDelay = time.Millisecond
+	DefaultHTTPClient.MaxDelay = 10 * time.Millisecond
+	DefaultHTTPClient.DefaultLimit = RateLimit{}
+	os.Exit(m.Run())
+}
+
+func newTestHTTPClient() *HTTPClient {
+	return &HTTPClient{
+		Client:     &http.Client{Timeout: 5 * time.Second},
+		MaxRetries: 3,
+		BaseDelay:  time.Millisecond,
+		MaxDelay:   time.Second,
+	}
+}
+
+func TestHTTPClient_RetryServerError(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	resp, err := newTestHTTPClient().Do(req)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "ok" {
+		t.Errorf("got %d %q, want 200 ok", resp.StatusCode, body)
+	}
+	if calls != 3 {
+		t.Errorf("calls = %d, want 3", calls)
+	}
+}
+
+func TestHTTPClient_GiveUp(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	resp, err := newTestHTTPClient().Do(req)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("status = %d, want 502", resp.StatusCode)
+	}
+	if calls != 4 {
+		t.Errorf("calls = %d, want 1 + 3 retries", calls)
+	}
+}
+
+func TestHTTPClient_NoRetryOnNotFound(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	resp, err := newTestHTTPClient().Do(req)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	resp.Body.Close()
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1", calls)
+	}
+}
+
+func TestHTTPClient_RetryAfter(t *testing.T) {
+	var calls int32
+	var first time.Time
+	var waited time.Duration
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			first = time.Now()
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		waited = time.Since(first)
+	}))
+	defer server.Close()
+
+	c := newTestHTTPClient()
+	c.MaxDelay = 2 * time.Second
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+	if waited < 900*time.Millisecond {
+		t.Errorf("retried after %s, want Retry-After of 1s", waited)
+	}
+
+	// A Retry-After longer than MaxDelay returns the 429 at once.
+	atomic.StoreInt32(&calls, 0)
+	c.MaxDelay = 100 * time.Millisecond
+	req, _ = http.NewRequest("GET", server.URL, nil)
+	resp, err = c.Do(req)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests || calls != 1 {
+		t.Errorf("got status %d after %d calls, want 429 after 1", resp.StatusCode, calls)
+	}
+}
+
+func TestHTTPClient_ReplayBody(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != `{"url":"x"}` {
+			t.Errorf("attempt %d body = %q", atomic.LoadInt32(&calls)+1, body)
+		}
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest("POST", server.URL, strings.NewReader(`{"url":"x"}`))
+	resp, err := newTestHTTPClient().Do(req)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || calls != 2 {
+		t.Errorf("got status %d after %d calls, want 200 after 2", resp.StatusCode, calls)
+	}
+}
+
+func TestHTTPClient_RateLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	c := newTestHTTPClient()
+	c.HostLimits = map[string]RateLimit{"127.0.0.1": {PerSecond: 20, Burst: 2}}
+
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		resp, err := c.Do(req)
+		if err != nil {
+			t.Fatalf("Do: %v", err)
+		}
+		resp.Body.Close()
+	}
+	// 2 requests of burst, then 4 at 20 per second.
+	if elapsed := time.Since(start); elapsed < 180*time.Millisecond {
+		t.Errorf("6 requests took %s, want at least 200ms", elapsed)
+	}
+
+	// Waiting for a token is cancellable.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	c.HostLimits["127.0.0.1"] = RateLimit{PerSecond: 0.1, Burst: 1}
+	c.buckets = nil
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+		resp, err := c.Do(req)
+		if err == nil {
+			resp.Body.Close()
+			continue
+		}
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("err = %v, want context.DeadlineExceeded", err)
+		}
+		return
+	}
+	t.Error("second request was not rate limited")
+}
+
+func TestRetryAfter(t *testing.T) {
+	if d, ok := retryAfter("3"); !ok || d != 3*time.Second {
+		t.Errorf("retryAfter(3) = %s, %v", d, ok)
+	}
+	date := time.Now().Add(5 * time.Second).UTC().Format(http.TimeFormat)
+	if d, ok := retryAfter(date); !ok || d < 3*time.Second || d > 5*time.Second {
+		t.Errorf("retryAfter(%s) = %s, %v", date, d, ok)
+	}
+	if _, ok := retryAfter("soon"); ok {
+		t.Error("retryAfter(soon) ok, want invalid")
+	}
+}
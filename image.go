@@ -0,0 +1,268 @@
+package photomgr
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"  // Register GIF for image.DecodeConfig
+	_ "image/jpeg" // Register JPEG for image.DecodeConfig
+	_ "image/png"  // Register PNG for image.DecodeConfig
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// sniffLen is the number of bytes needed by http.DetectContentType.
+const sniffLen = 512
+
+// imageFormats maps the sniffed content type to the file extension.
+var imageFormats = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+	"image/webp": "webp",
+	"image/bmp":  "bmp",
+}
+
+// isImageExt reports whether ext, without dot, is the extension of an image
+// format, "jpeg" included.
+func isImageExt(ext string) bool {
+	for _, format := range imageFormats {
+		if ext == format {
+			return true
+		}
+	}
+	return ext == "jpeg"
+}
+
+// sniffImageFormat detects the image format from the first bytes of the
+// content, it returns the file extension or "" if it is not an image.
+func sniffImageFormat(head []byte) string {
+	return imageFormats[http.DetectContentType(head)]
+}
+
+// decodeImageConfig reads the dimensions of an image of format, as returned
+// by sniffImageFormat, without decoding the whole image.
+func decodeImageConfig(r io.Reader, format string) (image.Config, error) {
+	switch format {
+	case "webp":
+		return decodeWebPConfig(r)
+	case "bmp":
+		return decodeBMPConfig(r)
+	}
+	cfg, _, err := image.DecodeConfig(r)
+	return cfg, err
+}
+
+// decodeWebPConfig parses the canvas size from the first chunk of a WebP
+// file, which is VP8 (lossy), VP8L (lossless) or VP8X (extended).
+func decodeWebPConfig(r io.Reader) (image.Config, error) {
+	var b [30]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return image.Config{}, fmt.Errorf("webp: %w", err)
+	}
+	if string(b[0:4]) != "RIFF" || string(b[8:12]) != "WEBP" {
+		return image.Config{}, errors.New("webp: invalid header")
+	}
+
+	var w, h int
+	switch string(b[12:16]) {
+	case "VP8 ":
+		// Frame tag (3 bytes) and start code 9d 01 2a, then 14 bit sizes.
+		if b[23] != 0x9d || b[24] != 0x01 || b[25] != 0x2a {
+			return image.Config{}, errors.New("webp: invalid VP8 start code")
+		}
+		w = int(binary.LittleEndian.Uint16(b[26:28]) & 0x3fff)
+		h = int(binary.LittleEndian.Uint16(b[28:30]) & 0x3fff)
+	case "VP8L":
+		// Signature 0x2f, then 14 bit width-1 and height-1.
+		if b[20] != 0x2f {
+			return image.Config{}, errors.New("webp: invalid VP8L signature")
+		}
+		bits := binary.LittleEndian.Uint32(b[21:25])
+		w = int(bits&0x3fff) + 1
+		h = int(bits>>14&0x3fff) + 1
+	case "VP8X":
+		// Flags (4 bytes), then 24 bit canvas width-1 and height-1.
+		w = int(uint32(b[24])|uint32(b[25])<<8|uint32(b[26])<<16) + 1
+		h = int(uint32(b[27])|uint32(b[28])<<8|uint32(b[29])<<16) + 1
+	default:
+		return image.Config{}, fmt.Errorf("webp: unknown chunk %q", b[12:16])
+	}
+	return image.Config{Width: w, Height: h}, nil
+}
+
+// decodeBMPConfig parses the size from the BITMAPINFOHEADER of a BMP file.
+func decodeBMPConfig(r io.Reader) (image.Config, error) {
+	var b [26]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return image.Config{}, fmt.Errorf("bmp: %w", err)
+	}
+	if string(b[0:2]) != "BM" {
+		return image.Config{}, errors.New("bmp: invalid header")
+	}
+	w := int(int32(binary.LittleEndian.Uint32(b[18:22])))
+	h := int(int32(binary.LittleEndian.Uint32(b[22:26])))
+	if h < 0 {
+		// Top-down bitmap.
+		h = -h
+	}
+	return image.Config{Width: w, Height: h}, nil
+}
+
+// imageFileName returns the file name of the image at target, the name is
+// the last path element of the URL and the extension comes from format.
+func imageFileName(target string, format string) string {
+	return imageBaseName(target) + "." + format
+}
+
+// imageBaseName returns the last path element of the image URL target
+// without extension.
+func imageBaseName(target string) string {
+	name := ""
+	if u, err := url.Parse(target); err == nil {
+		name = path.Base(u.Path)
+	}
+	name = strings.TrimSuffix(name, path.Ext(name))
+	if name == "" || name == "." || name == "/" {
+		name = "image"
+	}
+	return name
+}
+
+// savedImage is the result of writeImage.
+type savedImage struct {
+	File   string // File name in the album folder, empty when skipped
+	Size   int64
+	SHA256 string
+	// Skipped is the reason the image was not saved, such as "too small".
+	Skipped string
+	// DuplicateOf is the library path of the same content saved before. File
+	// is a hard link to it, or empty when linking is not possible.
+	DuplicateOf string
+	// Width and Height are read from the image header, also when skipped.
+	Width, Height int
+}
+
+// writeImage streams the response body of an image to destDir without
+// re-encoding it, so the saved file is bit-exact. Only the image header is
+// decoded to skip the images not kept by filter, nil means
+// DefaultImageFilter. The content is written to a temporary file first and
+// renamed when complete, or replaced by a hard link when lib already has the
+// same content. The file is named by name from the content format, or after
+// the URL if nil.
+func writeImage(lib *Library, destDir string, target string, name func(format string) string, filter *ImageFilter, body io.Reader) (savedImage, error) {
+	filter = filter.orDefault()
+	br := bufio.NewReaderSize(body, sniffLen)
+	head, err := br.Peek(sniffLen)
+	if err != nil && err != io.EOF && !errors.Is(err, bufio.ErrBufferFull) {
+		return savedImage{}, fmt.Errorf("read error: %w", err)
+	}
+	format := sniffImageFormat(head)
+	if format == "" {
+		return savedImage{}, fmt.Errorf("%w: %s is not an image (%s)", ErrParseFailed, target, http.DetectContentType(head))
+	}
+
+	// Keep the bytes consumed by decodeImageConfig to write them out later.
+	var consumed bytes.Buffer
+	cfg, err := decodeImageConfig(io.TeeReader(br, &consumed), format)
+	if err != nil {
+		return savedImage{}, fmt.Errorf("%w: decode %s config error: %v", ErrParseFailed, format, err)
+	}
+
+	if reason := filter.checkHeader(target, format, cfg.Width, cfg.Height); reason != "" {
+		return savedImage{Skipped: reason, Width: cfg.Width, Height: cfg.Height}, nil
+	}
+
+	fileName := imageFileName(target, format)
+	if name != nil {
+		fileName = name(format)
+	}
+	finalPath := filepath.Join(destDir, fileName)
+	tmp, err := os.CreateTemp(destDir, "."+fileName+".*.tmp")
+	if err != nil {
+		return savedImage{}, fmt.Errorf("os.CreateTemp error: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed
+
+	var content io.Reader = io.MultiReader(&consumed, br)
+	if filter.MaxBytes > 0 {
+		// One more byte tells a too large file.
+		content = io.LimitReader(content, filter.MaxBytes+1)
+	}
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), content)
+	if err != nil {
+		tmp.Close()
+		return savedImage{}, fmt.Errorf("write %s error: %w", finalPath, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return savedImage{}, fmt.Errorf("close %s error: %w", finalPath, err)
+	}
+	if filter.MaxBytes > 0 && size > filter.MaxBytes {
+		reason := fmt.Sprintf("file too large: more than %d bytes", filter.MaxBytes)
+		return savedImage{Skipped: reason, Width: cfg.Width, Height: cfg.Height}, nil
+	}
+	if reason := filter.checkSize(size); reason != "" {
+		return savedImage{Skipped: reason, Width: cfg.Width, Height: cfg.Height}, nil
+	}
+	saved := savedImage{File: fileName, Size: size, SHA256: hex.EncodeToString(hash.Sum(nil)), Width: cfg.Width, Height: cfg.Height}
+
+	if lib == nil {
+		if err := os.Rename(tmp.Name(), finalPath); err != nil {
+			return savedImage{}, err
+		}
+		return saved, nil
+	}
+
+	entry := LibraryEntry{SHA256: saved.SHA256, Size: size, Width: cfg.Width, Height: cfg.Height}
+	// The perceptual hash decodes the whole image, so it is computed before
+	// taking the library lock and only for content not in the library yet.
+	// Formats without a standard library decoder have none.
+	if _, ok := lib.Lookup(saved.SHA256); !ok {
+		if hash, err := DHashFile(tmp.Name()); err == nil {
+			entry.DHash = hash
+		}
+	}
+	original, err := lib.store(finalPath, entry, func() error {
+		return os.Rename(tmp.Name(), finalPath)
+	})
+	if err != nil {
+		return savedImage{}, err
+	}
+	if original != "" && original != finalPath {
+		return linkDuplicate(lib, original, finalPath, saved)
+	}
+	return saved, nil
+}
+
+// linkDuplicate makes finalPath a hard link to original, which has the same
+// content. When the file system can not link, only the reference to the
+// original is returned and nothing is written.
+func linkDuplicate(lib *Library, original string, finalPath string, saved savedImage) (savedImage, error) {
+	saved.DuplicateOf = lib.Rel(original)
+
+	if info, err := os.Stat(finalPath); err == nil {
+		if originalInfo, err := os.Stat(original); err == nil && os.SameFile(info, originalInfo) {
+			return saved, nil // Linked by a previous run
+		}
+		if err := os.Remove(finalPath); err != nil {
+			return savedImage{}, err
+		}
+	}
+	if err := os.Link(original, finalPath); err != nil {
+		log.Printf("link %s to %s error: %s, keep a reference only", finalPath, original, err)
+		saved.File = ""
+	}
+	return saved, nil
+}
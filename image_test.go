@@ -0,0 +1,160 @@
+package photomgr
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// encodeTestImage returns an encoded w x h image in format "jpg" or "png".
+func encodeTestImage(t *testing.T, format string, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	m := image.NewRGBA(image.Rect(0, 0, w, h))
+	var err error
+	if format == "png" {
+		err = png.Encode(&buf, m)
+	} else {
+		err = jpeg.Encode(&buf, m, &jpeg.Options{Quality: 95})
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// ck101TestThread is the path of the thread served by newCK101TestServer.
+const ck101TestThread = "/thread-3000000-1-1.html"
+
+// newCK101TestServer serves a CK101 thread "Album" by ckuser at
+// ck101TestThread, showing the images at paths in order. The images are
+// served by path, other paths are not found.
+func newCK101TestServer(t *testing.T, images map[string][]byte, paths ...string) *httptest.Server {
+	t.Helper()
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == ck101TestThread {
+			fmt.Fprint(w, `<html><body><h1>Album</h1><div id="postlist"><div id="post_1">
+				<div class="authi"><a href="space-uid-1.html" class="xw1">ckuser</a></div>
+				<div class="authi"><em id="authorposton1">發表於 <span title="2024-1-2 15:04:05">3 天前</span></em></div>
+				<div itemprop="articleBody">`)
+			for _, path := range paths {
+				fmt.Fprintf(w, `<img file="%s%s">`, server.URL, path)
+			}
+			fmt.Fprint(w, `</div></div></div></body></html>`)
+			return
+		}
+		data, ok := images[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// webpVP8XHeader returns the first bytes of an extended WebP of w x h.
+func webpVP8XHeader(w, h int) []byte {
+	b := []byte("RIFF\x00\x00\x00\x00WEBPVP8X\x0a\x00\x00\x00\x10\x00\x00\x00")
+	w, h = w-1, h-1
+	b = append(b, byte(w), byte(w>>8), byte(w>>16), byte(h), byte(h>>8), byte(h>>16))
+	return append(b, []byte("ALPH rest of the file")...)
+}
+
+func TestSaveImage_OriginalBytes(t *testing.T) {
+	pages := map[string][]byte{
+		"/big.jpg":    encodeTestImage(t, "jpg", 400, 500),
+		"/real.jpg":   encodeTestImage(t, "png", 640, 480), // PNG behind a .jpg URL
+		"/small.png":  encodeTestImage(t, "png", 100, 100),
+		"/anim.webp":  webpVP8XHeader(800, 600),
+		"/tiny.webp":  webpVP8XHeader(200, 200),
+		"/page.jpg":   []byte("<html><body>removed</body></html>"),
+		"/noext":      encodeTestImage(t, "jpg", 301, 301),
+		"/a/b/c.jpeg": encodeTestImage(t, "jpg", 301, 301),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if data, ok := pages[r.URL.Path]; ok {
+			w.Write(data)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	for _, name := range []string{"/big.jpg", "/real.jpg", "/small.png", "/anim.webp", "/tiny.webp", "/noext", "/a/b/c.jpeg"} {
+		if _, err := saveImage(context.Background(), nil, dir, server.URL+name, nil, nil); err != nil {
+			t.Errorf("saveImage(%s): %v", name, err)
+		}
+	}
+	if _, err := saveImage(context.Background(), nil, dir, server.URL+"/page.jpg", nil, nil); !errors.Is(err, ErrParseFailed) {
+		t.Errorf("Expected ErrParseFailed for a HTML page, got %v", err)
+	}
+
+	expected := map[string][]byte{
+		"big.jpg":   pages["/big.jpg"],
+		"real.png":  pages["/real.jpg"],
+		"anim.webp": pages["/anim.webp"],
+		"noext.jpg": pages["/noext"],
+		"c.jpg":     pages["/a/b/c.jpeg"],
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(expected) {
+		names := []string{}
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Errorf("Expected %d files without temporary files, got %v", len(expected), names)
+	}
+	for name, data := range expected {
+		saved, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("Expected %s to be saved: %v", name, err)
+			continue
+		}
+		if !bytes.Equal(saved, data) {
+			t.Errorf("%s is not bit-exact: %d bytes saved, %d served", name, len(saved), len(data))
+		}
+	}
+}
+
+func TestDecodeWebPConfig(t *testing.T) {
+	lossy := []byte("RIFF\x00\x00\x00\x00WEBPVP8 \x00\x00\x00\x00\x00\x00\x00\x9d\x01\x2a\x90\x01\x2c\x01")
+	lossless := []byte("RIFF\x00\x00\x00\x00WEBPVP8L\x00\x00\x00\x00\x2f")
+	// 14 bit width-1 = 399 and height-1 = 299.
+	bits := uint32(399) | uint32(299)<<14
+	lossless = append(lossless, byte(bits), byte(bits>>8), byte(bits>>16), byte(bits>>24), 0, 0, 0, 0, 0)
+
+	tests := []struct {
+		name string
+		data []byte
+		w, h int
+	}{
+		{"VP8", lossy, 400, 300},
+		{"VP8L", lossless, 400, 300},
+		{"VP8X", webpVP8XHeader(1024, 768), 1024, 768},
+	}
+	for _, tt := range tests {
+		if format := sniffImageFormat(tt.data); format != "webp" {
+			t.Errorf("%s: expected webp format, got %q", tt.name, format)
+		}
+		cfg, err := decodeImageConfig(bytes.NewReader(tt.data), "webp")
+		if err != nil || cfg.Width != tt.w || cfg.Height != tt.h {
+			t.Errorf("%s: expected %dx%d, got %dx%d (%v)", tt.name, tt.w, tt.h, cfg.Width, cfg.Height, err)
+		}
+	}
+}
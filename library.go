@@ -0,0 +1,213 @@
+package photomgr
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// LibraryIndexFileName is the name of the content index in the base folder.
+const LibraryIndexFileName = ".photomgr-library.jsonl"
+
+// LibraryEntry is a saved image in the library content index.
+type LibraryEntry struct {
+	SHA256 string `json:"sha256"`
+	// File is the path relative to the library root, or an absolute path for
+	// files outside of it.
+	File string `json:"file"`
+	Size int64  `json:"size"`
+	// Width, Height and the perceptual DHash are used to find re-compressed
+	// or resized copies, see Library.Clusters.
+	Width  int       `json:"width,omitempty"`
+	Height int       `json:"height,omitempty"`
+	DHash  ImageHash `json:"dhash,omitempty"`
+}
+
+// Library is the content index of every image saved under a base folder, so
+// an image reposted in many albums is stored once: later copies are hard
+// links to the first one. The perceptual hash of every image is kept too, to
+// find re-compressed or resized copies, see Clusters. The index is an append
+// only JSON lines file, the last line of a hash wins. It is safe for
+// concurrent use.
+type Library struct {
+	root    string
+	mu      sync.Mutex
+	entries map[string]LibraryEntry // SHA-256 -> entry
+}
+
+var (
+	librariesMu sync.Mutex
+	libraries   = make(map[string]*Library)
+)
+
+// OpenLibrary returns the library of base folder root, all callers in the
+// process share the same instance for a root.
+func OpenLibrary(root string) (*Library, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	librariesMu.Lock()
+	defer librariesMu.Unlock()
+	if l, ok := libraries[root]; ok {
+		return l, nil
+	}
+
+	l := &Library{root: root, entries: make(map[string]LibraryEntry)}
+	if err := l.load(); err != nil {
+		return nil, err
+	}
+	libraries[root] = l
+	return l, nil
+}
+
+// libraryFor returns the library of base folder root, or nil after logging
+// the error so downloads go on without deduplication.
+func libraryFor(root string) *Library {
+	l, err := OpenLibrary(root)
+	if err != nil {
+		log.Printf("library error: %s, deduplication is disabled", err)
+		return nil
+	}
+	return l
+}
+
+// Root returns the absolute base folder of the library.
+func (l *Library) Root() string {
+	return l.root
+}
+
+// Len returns the number of distinct images in the library.
+func (l *Library) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.entries)
+}
+
+func (l *Library) indexPath() string {
+	return filepath.Join(l.root, LibraryIndexFileName)
+}
+
+func (l *Library) load() error {
+	f, err := os.Open(l.indexPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry LibraryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// A line cut by a crash, the image is indexed again when seen.
+			log.Printf("library: skip invalid line in %s: %v", l.indexPath(), err)
+			continue
+		}
+		l.entries[entry.SHA256] = entry
+	}
+	return scanner.Err()
+}
+
+// Path returns the absolute path of a library file, such as LibraryEntry.File.
+func (l *Library) Path(file string) string {
+	if filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.Join(l.root, file)
+}
+
+// Lookup returns the absolute path of the saved image with hash sum. Entries
+// whose file was removed or changed are dropped.
+func (l *Library) Lookup(sum string) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lookup(sum)
+}
+
+func (l *Library) lookup(sum string) (string, bool) {
+	entry, ok := l.entries[sum]
+	if !ok {
+		return "", false
+	}
+	p := l.Path(entry.File)
+	if info, err := os.Stat(p); err != nil || info.Size() != entry.Size {
+		delete(l.entries, sum)
+		return "", false
+	}
+	return p, true
+}
+
+// Add indexes the saved image at path, the File of entry is set from path.
+func (l *Library) Add(path string, entry LibraryEntry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.add(path, entry)
+}
+
+func (l *Library) add(path string, entry LibraryEntry) error {
+	file, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	entry.File = l.Rel(file)
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(l.root, 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.indexPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("library: write %s: %w", l.indexPath(), err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	l.entries[entry.SHA256] = entry
+	return nil
+}
+
+// store returns the path of the saved image with the SHA-256 of entry if
+// any. Otherwise it calls save, which writes the image to path, and indexes
+// it. Both happen under the library lock, so two albums saving the same
+// content at the same time still store it once. save should be quick, as it
+// blocks every other save of the library.
+func (l *Library) store(path string, entry LibraryEntry, save func() error) (original string, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if original, ok := l.lookup(entry.SHA256); ok {
+		return original, nil
+	}
+	if err := save(); err != nil {
+		return "", err
+	}
+	if err := l.add(path, entry); err != nil {
+		log.Printf("library error: %s, file: %s", err, path)
+	}
+	return "", nil
+}
+
+// Rel returns path relative to the library root when it is inside it.
+func (l *Library) Rel(path string) string {
+	if rel, err := filepath.Rel(l.root, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(rel)
+	}
+	return path
+}
@@ -0,0 +1,78 @@
+package photomgr
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDownloadImages_LibraryDedup(t *testing.T) {
+	img := encodeTestImage(t, "jpg", 400, 400)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(img) // Every URL is the same repost
+	}))
+	defer server.Close()
+
+	root := t.TempDir()
+	lib, err := OpenLibrary(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := OpenLibrary(root); again != lib {
+		t.Error("Expected OpenLibrary to share the instance of a root")
+	}
+
+	b := &baseCrawler{}
+	album1 := filepath.Join(root, "PTT - first")
+	album2 := filepath.Join(root, "PTT - second")
+	for _, dir := range []string{album1, album2} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.downloadImages(context.Background(), lib, &DownloadReport{Dir: album1}, []string{server.URL + "/a.jpg", server.URL + "/b.jpg"}, downloadOptions{}, 2, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.downloadImages(context.Background(), lib, &DownloadReport{Dir: album2}, []string{server.URL + "/c.jpg"}, downloadOptions{}, 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if lib.Len() != 1 {
+		t.Errorf("Expected 1 distinct image in library, got %d", lib.Len())
+	}
+
+	// Every album still has its file, all linked to the same content.
+	var infos []os.FileInfo
+	for _, file := range []string{filepath.Join(album1, "a.jpg"), filepath.Join(album1, "b.jpg"), filepath.Join(album2, "c.jpg")} {
+		info, err := os.Stat(file)
+		if err != nil {
+			t.Fatalf("Expected %s to exist: %v", file, err)
+		}
+		infos = append(infos, info)
+	}
+	for _, info := range infos[1:] {
+		if !os.SameFile(infos[0], info) {
+			t.Errorf("Expected %s to be a hard link of %s", info.Name(), infos[0].Name())
+		}
+	}
+
+	manifest, err := LoadManifest(album2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, _ := manifest.Entry(server.URL + "/c.jpg")
+	if entry.Status != ImageDone || entry.File != "c.jpg" || (entry.DuplicateOf != "PTT - first/a.jpg" && entry.DuplicateOf != "PTT - first/b.jpg") {
+		t.Errorf("Unexpected manifest entry of duplicate: %+v", entry)
+	}
+
+	// The index is reloaded from disk.
+	reloaded := &Library{root: lib.Root(), entries: make(map[string]LibraryEntry)}
+	if err := reloaded.load(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := reloaded.Lookup(entry.SHA256); !ok || reloaded.Len() != 1 {
+		t.Errorf("Expected reloaded library to find %s", entry.SHA256)
+	}
+}
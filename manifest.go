@@ -0,0 +1,233 @@
+package photomgr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ManifestFileName is the name of the manifest file in every album folder.
+const ManifestFileName = "manifest.json"
+
+// Status of an image in the album manifest.
+const (
+	// ImageDone means the image is saved in the album.
+	ImageDone = "done"
+	// ImageSkipped means the image was filtered out, such as small images,
+	// and it is not downloaded again.
+	ImageSkipped = "skipped"
+	// ImageFailed means the download failed, it is retried on the next run.
+	ImageFailed = "failed"
+)
+
+// ManifestEntry records the download result of a single image.
+type ManifestEntry struct {
+	URL    string `json:"url"`
+	Status string `json:"status"`
+	// Seq is the position of the image in the post, from 1.
+	Seq int `json:"seq,omitempty"`
+	// File is the saved file name relative to the album folder.
+	File   string `json:"file,omitempty"`
+	Size   int64  `json:"size,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+	// DuplicateOf is the library path of the same image saved in another
+	// album, File is a hard link to it or empty if linking failed.
+	DuplicateOf string `json:"duplicate_of,omitempty"`
+	// Error is the reason of a failed or skipped image.
+	Error   string    `json:"error,omitempty"`
+	Updated time.Time `json:"updated"`
+}
+
+// saved reports whether the image of a done entry is still in album folder
+// dir: its file, or the library file of lib it refers to when not linked.
+func (e ManifestEntry) saved(dir string, lib *Library) bool {
+	if e.File != "" {
+		_, err := os.Stat(filepath.Join(dir, e.File))
+		return err == nil
+	}
+	if e.DuplicateOf == "" || lib == nil {
+		return false
+	}
+	_, err := os.Stat(lib.Path(e.DuplicateOf))
+	return err == nil
+}
+
+// Manifest lists every image of an album folder with its download status, so
+// an interrupted or edited album can be resumed by downloading only the
+// missing or failed images. It is safe for concurrent use.
+type Manifest struct {
+	// Filter is the ImageFilter of the last complete download of the album,
+	// nil for DefaultImageFilter as in earlier versions. Skipped images are
+	// checked again when the filter changes.
+	Filter  *ImageFilter    `json:"filter,omitempty"`
+	Entries []ManifestEntry `json:"entries"` // In the order recorded, see ManifestEntry.Seq
+
+	mu    sync.Mutex
+	path  string
+	index map[string]int    // URL -> position in Entries
+	files map[string]string // File -> URL, see claimFile
+}
+
+// LoadManifest reads the manifest of album folder dir, a missing manifest
+// returns an empty one which is created on the first Record.
+func LoadManifest(dir string) (*Manifest, error) {
+	m := &Manifest{path: filepath.Join(dir, ManifestFileName), index: make(map[string]int), files: make(map[string]string)}
+	data, err := os.ReadFile(m.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrParseFailed, m.path, err)
+	}
+	for i, entry := range m.Entries {
+		m.index[entry.URL] = i
+		if entry.File != "" {
+			m.files[entry.File] = entry.URL
+		}
+	}
+	return m, nil
+}
+
+// adoptFiles records the images of a folder of an earlier version, which has
+// no manifest and named the files after the image URL, as done with the file
+// of the same name, so they are not downloaded again under other names.
+// Nothing is done once the manifest has entries.
+func (m *Manifest) adoptFiles(dir string, images []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.Entries) > 0 {
+		return nil
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	byName := make(map[string]os.DirEntry)
+	for _, file := range files {
+		ext := strings.ToLower(strings.TrimPrefix(path.Ext(file.Name()), "."))
+		if !file.Type().IsRegular() || !isImageExt(ext) {
+			continue
+		}
+		name := strings.TrimSuffix(file.Name(), path.Ext(file.Name()))
+		if _, ok := byName[name]; !ok {
+			byName[name] = file
+		}
+	}
+
+	now := time.Now()
+	for i, url := range images {
+		file, ok := byName[imageBaseName(url)]
+		if !ok {
+			continue
+		}
+		if _, claimed := m.files[file.Name()]; claimed {
+			continue
+		}
+		if _, dup := m.index[url]; dup {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		m.index[url] = len(m.Entries)
+		m.files[file.Name()] = url
+		m.Entries = append(m.Entries, ManifestEntry{URL: url, Status: ImageDone, Seq: i + 1, File: file.Name(), Size: info.Size(), Updated: now})
+	}
+	if len(m.Entries) == 0 {
+		return nil
+	}
+	return m.save()
+}
+
+// claimFile returns the file name for image url in the album: name, or name
+// with a number added when another image already has it, so images with the
+// same name from different hosts do not overwrite each other.
+func (m *Manifest) claimFile(name string, url string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ext := path.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	file := name
+	for n := 2; ; n++ {
+		if owner, ok := m.files[file]; !ok || owner == url {
+			break
+		}
+		file = fmt.Sprintf("%s-%d%s", stem, n, ext)
+	}
+	m.files[file] = url
+	return file
+}
+
+// Entry returns the entry of image url.
+func (m *Manifest) Entry(url string) (ManifestEntry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i, ok := m.index[url]
+	if !ok {
+		return ManifestEntry{}, false
+	}
+	return m.Entries[i], true
+}
+
+// sameFilter reports whether the skipped images of the manifest were
+// checked with filter.
+func (m *Manifest) sameFilter(filter *ImageFilter) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.Filter.orDefault().equal(filter.orDefault())
+}
+
+// setFilter records filter as the one of the skipped images and saves the
+// manifest.
+func (m *Manifest) setFilter(filter *ImageFilter) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	filter = filter.orDefault()
+	if m.Filter.orDefault().equal(filter) {
+		return nil
+	}
+	m.Filter = filter
+	return m.save()
+}
+
+// Record adds or updates the entry of entry.URL and saves the manifest.
+func (m *Manifest) Record(entry ManifestEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if entry.Updated.IsZero() {
+		entry.Updated = time.Now()
+	}
+	if i, ok := m.index[entry.URL]; ok {
+		m.Entries[i] = entry
+	} else {
+		m.index[entry.URL] = len(m.Entries)
+		m.Entries = append(m.Entries, entry)
+	}
+	return m.save()
+}
+
+// save writes the manifest to a temporary file and renames it, so it is never
+// left half written.
+func (m *Manifest) save() error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(m.path, data)
+}
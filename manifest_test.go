@@ -0,0 +1,192 @@
+package photomgr
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDownloadImages_ResumeFromManifest(t *testing.T) {
+	big := encodeTestImage(t, "jpg", 400, 400)
+	small := encodeTestImage(t, "png", 10, 10)
+
+	var mu sync.Mutex
+	requests := map[string]int{}
+	failFlaky := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests[r.URL.Path]++
+		switch r.URL.Path {
+		case "/big.jpg", "/flaky.jpg":
+			if r.URL.Path == "/flaky.jpg" && failFlaky {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.Write(big)
+		case "/small.png":
+			w.Write(small)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	b := &baseCrawler{}
+	images := []string{server.URL + "/big.jpg", server.URL + "/flaky.jpg", server.URL + "/small.png"}
+	if err := b.downloadImages(context.Background(), nil, &DownloadReport{Dir: dir}, images, downloadOptions{}, 2, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	manifest, err := LoadManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(big)
+	if entry, _ := manifest.Entry(images[0]); entry.Status != ImageDone || entry.File != "big.jpg" ||
+		entry.Size != int64(len(big)) || entry.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("Unexpected entry for big image: %+v", entry)
+	}
+	if entry, _ := manifest.Entry(images[1]); entry.Status != ImageFailed || entry.Error == "" {
+		t.Errorf("Unexpected entry for flaky image: %+v", entry)
+	}
+	if entry, _ := manifest.Entry(images[2]); entry.Status != ImageSkipped {
+		t.Errorf("Unexpected entry for small image: %+v", entry)
+	}
+
+	// An edit added a new image, and the flaky server recovered.
+	mu.Lock()
+	failFlaky = false
+	mu.Unlock()
+	images = append(images, server.URL+"/new.jpg")
+	if err := b.downloadImages(context.Background(), nil, &DownloadReport{Dir: dir}, images, downloadOptions{}, 2, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// The failed run made 1 + MaxRetries requests for the flaky image.
+	flakyRequests := 1 + DefaultHTTPClient.MaxRetries + 1
+	expected := map[string]int{"/big.jpg": 1, "/flaky.jpg": flakyRequests, "/small.png": 1, "/new.jpg": 1}
+	for path, count := range expected {
+		if requests[path] != count {
+			t.Errorf("Expected %d requests for %s, got %d", count, path, requests[path])
+		}
+	}
+	manifest, _ = LoadManifest(dir)
+	if len(manifest.Entries) != 4 {
+		t.Fatalf("Expected 4 manifest entries, got %+v", manifest.Entries)
+	}
+	if entry, _ := manifest.Entry(images[1]); entry.Status != ImageDone || entry.File != "flaky.jpg" {
+		t.Errorf("Expected flaky image done after resume, got %+v", entry)
+	}
+	// new.jpg is served as an empty body, so it failed and is retried on the next run.
+	if entry, _ := manifest.Entry(images[3]); entry.Status != ImageFailed {
+		t.Errorf("Expected the new image failed, got %+v", entry)
+	}
+}
+
+func TestDownloadImages_MissingFile(t *testing.T) {
+	big := encodeTestImage(t, "jpg", 400, 400)
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write(big)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	b := &baseCrawler{}
+	images := []string{server.URL + "/a.jpg", server.URL + "/b.jpg"}
+	report := &DownloadReport{Dir: dir}
+	if err := b.downloadImages(context.Background(), nil, report, images, downloadOptions{}, 2, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// A file removed from the album is downloaded again, the other one not.
+	if err := os.Remove(report.Images[0].Path); err != nil {
+		t.Fatal(err)
+	}
+	again := &DownloadReport{Dir: dir}
+	if err := b.downloadImages(context.Background(), nil, again, images, downloadOptions{}, 2, nil); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 3 || again.Images[0].Resumed || !again.Images[1].Resumed {
+		t.Errorf("Expected only the removed image downloaded again, got %d requests, %+v", requests, again.Images)
+	}
+	if _, err := os.Stat(again.Images[0].Path); err != nil {
+		t.Errorf("Expected the removed image saved again: %v", err)
+	}
+}
+
+func TestManifestEntry_SavedReference(t *testing.T) {
+	root := t.TempDir()
+	lib, err := OpenLibrary(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "original.jpg"), []byte("image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A reference to a library file, the album has no link to it.
+	entry := ManifestEntry{Status: ImageDone, DuplicateOf: "original.jpg"}
+	if !entry.saved(t.TempDir(), lib) {
+		t.Error("Expected the reference saved while the library file exists")
+	}
+	if entry.saved(t.TempDir(), nil) {
+		t.Error("Expected the reference not saved without the library")
+	}
+	os.Remove(filepath.Join(root, "original.jpg"))
+	if entry.saved(t.TempDir(), lib) {
+		t.Error("Expected the reference not saved once the library file is removed")
+	}
+}
+
+func TestDownloadImages_EarlierVersionFolder(t *testing.T) {
+	big := encodeTestImage(t, "jpg", 400, 400)
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write(big)
+	}))
+	defer server.Close()
+
+	// Folders of earlier versions have no manifest and the files are named
+	// after the image URL.
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.jpeg"), []byte("old image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	b := &baseCrawler{}
+	opts := downloadOptions{names: func(index int, target string, format string) string {
+		return fmt.Sprintf("%03d.%s", index+1, format)
+	}}
+	images := []string{server.URL + "/a.jpg", server.URL + "/b.jpg"}
+	report := &DownloadReport{Dir: dir}
+	if err := b.downloadImages(context.Background(), nil, report, images, opts, 2, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if requests != 1 || !report.Images[0].Resumed || report.Images[0].Path != filepath.Join(dir, "a.jpeg") {
+		t.Errorf("Expected the existing file kept, got %d requests, %+v", requests, report.Images[0])
+	}
+	if report.Images[1].Path != filepath.Join(dir, "002.jpg") {
+		t.Errorf("Expected the new image named by the template, got %+v", report.Images[1])
+	}
+	if _, err := os.Stat(filepath.Join(dir, "001.jpg")); !os.IsNotExist(err) {
+		t.Errorf("Expected no copy of the existing file, got %v", err)
+	}
+	manifest, err := LoadManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry, _ := manifest.Entry(images[0]); entry.Status != ImageDone || entry.File != "a.jpeg" || entry.Seq != 1 {
+		t.Errorf("Unexpected entry of the existing file: %+v", entry)
+	}
+}
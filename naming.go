@@ -0,0 +1,406 @@
+package photomgr
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// DefaultMaxNameLength is the maximum length in bytes of every folder and
+// file name made by a NameTemplate, below the 255 bytes of most file systems
+// to leave room for the temporary files of the downloads.
+const DefaultMaxNameLength = 200
+
+// Default naming templates of the sites, they keep the album folders of the
+// earlier versions. Files are numbered in post order, use "{seq:03}
+// {name}.{ext}" to keep the name of the image URL too.
+const (
+	DefaultPTTNameTemplate     = "PTT - {title}/{seq:03}.{ext}"
+	DefaultCK101NameTemplate   = "CK101 - {title}/{seq:03}.{ext}"
+	DefaultFBAlbumNameTemplate = "FBAlbum - {title}/{seq:03}.{ext}"
+)
+
+// namePlaceholderRegex matches a placeholder such as {title} or {seq:03}.
+var namePlaceholderRegex = regexp.MustCompile(`\{([a-z_]+)(?::(\d+))?\}`)
+
+// Placeholders of a NameTemplate, the file ones are only allowed in the last
+// path element.
+var (
+	albumPlaceholders = map[string]bool{"site": true, "board": true, "article_id": true, "title": true,
+		"author": true, "yyyy": true, "mm": true, "dd": true}
+	filePlaceholders = map[string]bool{"seq": true, "name": true, "ext": true}
+)
+
+// NameVars are the post values of the placeholders of a NameTemplate.
+type NameVars struct {
+	Site      string
+	Board     string
+	ArticleID string
+	Title     string
+	Author    string
+	// Time is the post time, shown in Taiwan time. The zero time is shown as
+	// 0000-00-00.
+	Time time.Time
+}
+
+// nameVarsFromMeta returns the naming values of the post of meta.
+func nameVarsFromMeta(meta *PostMeta) NameVars {
+	return NameVars{
+		Site:      meta.Site,
+		Board:     meta.Board,
+		ArticleID: meta.ArticleID,
+		Title:     meta.Title,
+		Author:    meta.Author,
+		Time:      meta.Time,
+	}
+}
+
+// nameSegment is a literal text, or a placeholder when key is set.
+type nameSegment struct {
+	text  string
+	key   string
+	width int // Zero padded width of {seq}
+}
+
+// NameTemplate builds the album folder and the image file names of a
+// download from a template such as
+//
+//	{site}/{board}/{yyyy}-{mm}/{article_id} {title}/{seq:03}.{ext}
+//
+// The last path element is the file name and the others the album folder,
+// relative to the base folder. The placeholders are {site}, {board},
+// {article_id}, {title}, {author}, {yyyy}, {mm} and {dd} of the post, and in
+// the file name {seq} (the position of the image in the post from 1, zero
+// padded to an optional width as in {seq:3}), {name} (the name of the image
+// URL without extension) and {ext} (the extension of the real content).
+//
+// Every folder and file name is sanitized: path separators, characters not
+// allowed on Windows and control characters become "_", leading and trailing
+// spaces and dots are removed, and it is cut to MaxLength bytes keeping the
+// extension.
+type NameTemplate struct {
+	// MaxLength is the maximum length in bytes of every folder and file
+	// name, 0 means DefaultMaxNameLength.
+	MaxLength int
+
+	template string
+	album    [][]nameSegment
+	file     []nameSegment
+}
+
+// ParseNameTemplate parses a naming template, see NameTemplate. The file
+// name must have {seq} or {name}, so the images of an album do not collide.
+func ParseNameTemplate(template string) (*NameTemplate, error) {
+	elements := strings.Split(template, "/")
+	if len(elements) < 2 {
+		return nil, fmt.Errorf("name template %q: no album folder", template)
+	}
+
+	t := &NameTemplate{template: template}
+	for i, element := range elements {
+		if strings.TrimSpace(element) == "" || element == "." || element == ".." {
+			return nil, fmt.Errorf("name template %q: invalid path element %q", template, element)
+		}
+		last := i == len(elements)-1
+		var segments []nameSegment
+		pos := 0
+		for _, m := range namePlaceholderRegex.FindAllStringSubmatchIndex(element, -1) {
+			key, width := element[m[2]:m[3]], 0
+			if m[4] >= 0 {
+				n, err := strconv.Atoi(element[m[4]:m[5]])
+				if err != nil {
+					return nil, fmt.Errorf("name template %q: invalid width of {%s}: %w", template, key, err)
+				}
+				width = n
+			}
+			switch {
+			case filePlaceholders[key] && !last:
+				return nil, fmt.Errorf("name template %q: {%s} is only allowed in the file name", template, key)
+			case !albumPlaceholders[key] && !filePlaceholders[key]:
+				return nil, fmt.Errorf("name template %q: unknown placeholder {%s}", template, key)
+			case m[4] >= 0 && key != "seq":
+				return nil, fmt.Errorf("name template %q: only {seq} has a width", template)
+			}
+			if m[0] > pos {
+				segments = append(segments, nameSegment{text: element[pos:m[0]]})
+			}
+			segments = append(segments, nameSegment{key: key, width: width})
+			pos = m[1]
+		}
+		if pos < len(element) {
+			segments = append(segments, nameSegment{text: element[pos:]})
+		}
+		if last {
+			t.file = segments
+		} else {
+			t.album = append(t.album, segments)
+		}
+	}
+
+	if !strings.Contains(elements[len(elements)-1], "{seq") && !strings.Contains(elements[len(elements)-1], "{name}") {
+		return nil, fmt.Errorf("name template %q: the file name needs {seq} or {name}", template)
+	}
+	return t, nil
+}
+
+// MustParseNameTemplate is like ParseNameTemplate but panics on error, for
+// templates known to be valid.
+func MustParseNameTemplate(template string) *NameTemplate {
+	t, err := ParseNameTemplate(template)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// String returns the template.
+func (t *NameTemplate) String() string {
+	return t.template
+}
+
+func (t *NameTemplate) maxLength() int {
+	if t.MaxLength > 0 {
+		return t.MaxLength
+	}
+	return DefaultMaxNameLength
+}
+
+// AlbumDir returns the album folder of a post, relative to the base folder.
+func (t *NameTemplate) AlbumDir(vars NameVars) string {
+	return t.albumDir(vars, "")
+}
+
+// albumDir is AlbumDir with suffix added to the last folder name, always
+// kept whole by the length limit. With a MaxLength too short for the suffix,
+// the name is a single byte and the suffix.
+func (t *NameTemplate) albumDir(vars NameVars, suffix string) string {
+	names := make([]string, len(t.album))
+	for i, segments := range t.album {
+		if i == len(t.album)-1 && suffix != "" {
+			max := t.maxLength() - len(suffix)
+			if max < 1 {
+				max = 1
+			}
+			names[i] = sanitizeName(expandName(segments, vars, 0, "", ""), max) + suffix
+			continue
+		}
+		names[i] = sanitizeName(expandName(segments, vars, 0, "", ""), t.maxLength())
+	}
+	return filepath.Join(names...)
+}
+
+// FileName returns the file name of the image at position seq of a post,
+// from 1. name is the name of the image URL without extension, and ext the
+// extension of the content.
+func (t *NameTemplate) FileName(vars NameVars, seq int, name string, ext string) string {
+	return sanitizeFileName(expandName(t.file, vars, seq, name, ext), t.maxLength())
+}
+
+// fileNamer returns the file names of the images of a post for
+// downloadImages.
+func (t *NameTemplate) fileNamer(vars NameVars) fileNamer {
+	return func(index int, target string, format string) string {
+		return t.FileName(vars, index+1, imageBaseName(target), format)
+	}
+}
+
+func expandName(segments []nameSegment, vars NameVars, seq int, name string, ext string) string {
+	var b strings.Builder
+	for _, s := range segments {
+		if s.key == "" {
+			b.WriteString(s.text)
+			continue
+		}
+		var local time.Time
+		if !vars.Time.IsZero() {
+			local = vars.Time.In(taiwanLocation)
+		}
+		switch s.key {
+		case "site":
+			b.WriteString(strings.TrimSpace(vars.Site))
+		case "board":
+			b.WriteString(strings.TrimSpace(vars.Board))
+		case "article_id":
+			b.WriteString(strings.TrimSpace(vars.ArticleID))
+		case "title":
+			b.WriteString(strings.TrimSpace(vars.Title))
+		case "author":
+			b.WriteString(strings.TrimSpace(vars.Author))
+		case "yyyy":
+			b.WriteString(datePart(local, local.Year(), "%04d"))
+		case "mm":
+			b.WriteString(datePart(local, int(local.Month()), "%02d"))
+		case "dd":
+			b.WriteString(datePart(local, local.Day(), "%02d"))
+		case "seq":
+			b.WriteString(fmt.Sprintf("%0*d", s.width, seq))
+		case "name":
+			b.WriteString(name)
+		case "ext":
+			b.WriteString(ext)
+		}
+	}
+	return b.String()
+}
+
+func datePart(t time.Time, v int, format string) string {
+	if t.IsZero() {
+		v = 0
+	}
+	return fmt.Sprintf(format, v)
+}
+
+// windowsReservedNames are the device names which can not be a file name on
+// Windows, with or without extension.
+var windowsReservedNames = map[string]bool{"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true}
+
+// sanitizeName returns s as a single folder or file name of at most max
+// bytes, see NameTemplate. It is never empty.
+func sanitizeName(s string, max int) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r < 0x20 || r == 0x7f || r == utf8.RuneError:
+			return '_'
+		case strings.ContainsRune(`/\:*?"<>|`, r):
+			return '_'
+		}
+		return r
+	}, s)
+	s = strings.Trim(s, " .")
+	if len(s) > max {
+		s = strings.TrimRight(truncateUTF8(s, max), " .")
+	}
+	if s == "" {
+		return "_"
+	}
+	if base, _, _ := strings.Cut(s, "."); windowsReservedNames[strings.ToUpper(base)] {
+		s = "_" + s
+	}
+	return s
+}
+
+// sanitizeFileName is sanitizeName keeping the extension when cut.
+func sanitizeFileName(s string, max int) string {
+	s = sanitizeName(s, len(s)+1)
+	ext := path.Ext(s)
+	if len(s) <= max || len(ext) >= max/2 {
+		return sanitizeName(s, max)
+	}
+	return sanitizeName(truncateUTF8(strings.TrimSuffix(s, ext), max-len(ext)), max-len(ext)) + ext
+}
+
+// truncateUTF8 cuts s to at most max bytes without splitting a character.
+func truncateUTF8(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	if max <= 0 {
+		return ""
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max]
+}
+
+// albumOwners maps every album folder used by a download of the process to
+// the key of its post, so concurrent downloads of posts with the same title
+// do not share a folder before their post.json is written.
+var (
+	albumOwnersMu sync.Mutex
+	albumOwners   = make(map[string]string)
+)
+
+// albumKey identifies the post of meta across downloads.
+func albumKey(meta *PostMeta) string {
+	if meta.ArticleID != "" {
+		return meta.Site + "/" + meta.ArticleID
+	}
+	return meta.URL
+}
+
+// albumSuffix is added to the album folder of a post whose name is used by
+// another post: the article ID, or a short hash of the URL without one.
+func albumSuffix(meta *PostMeta) string {
+	id := meta.ArticleID
+	if id == "" {
+		sum := sha1.Sum([]byte(meta.URL))
+		id = hex.EncodeToString(sum[:4])
+	}
+	return " [" + id + "]"
+}
+
+// makeAlbumDir creates the album folder of the post of meta under baseDir
+// from template t and returns it. A folder owned by another post, by its
+// post.json or by a download of this process, is not reused: the article ID
+// is added to the name instead. Folders without post.json, from earlier
+// versions, are reused.
+func makeAlbumDir(baseDir string, t *NameTemplate, meta *PostMeta) (string, error) {
+	vars := nameVarsFromMeta(meta)
+	key := albumKey(meta)
+
+	albumOwnersMu.Lock()
+	defer albumOwnersMu.Unlock()
+	for _, suffix := range []string{"", albumSuffix(meta)} {
+		dir := filepath.Join(baseDir, t.albumDir(vars, suffix))
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return "", err
+		}
+		owner, claimed := albumOwners[abs]
+		if !claimed {
+			if existing, err := LoadPostMeta(dir); err == nil && existing.URL != "" {
+				owner, claimed = albumKey(existing), true
+			}
+		}
+		if claimed && owner != key {
+			continue
+		}
+
+		// Existing albums are resumed from their manifest, see downloadImages.
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return "", err
+		}
+		albumOwners[abs] = key
+		return dir, nil
+	}
+	return "", fmt.Errorf("album folder of %s is used by another post", meta.URL)
+}
+
+var (
+	defaultPTTNaming     = MustParseNameTemplate(DefaultPTTNameTemplate)
+	defaultCK101Naming   = MustParseNameTemplate(DefaultCK101NameTemplate)
+	defaultFBAlbumNaming = MustParseNameTemplate(DefaultFBAlbumNameTemplate)
+)
+
+func (p *PTT) naming() *NameTemplate {
+	if p.Naming != nil {
+		return p.Naming
+	}
+	return defaultPTTNaming
+}
+
+func (p *CK101) naming() *NameTemplate {
+	if p.Naming != nil {
+		return p.Naming
+	}
+	return defaultCK101Naming
+}
+
+func (p *FBAlbum) naming() *NameTemplate {
+	if p.Naming != nil {
+		return p.Naming
+	}
+	return defaultFBAlbumNaming
+}
@@ -0,0 +1,172 @@
+package photomgr
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestParseNameTemplate_Invalid(t *testing.T) {
+	for _, template := range []string{
+		"{title}/",
+		"{name}.{ext}",
+		"{title}/../{name}.{ext}",
+		"{seq}/{name}.{ext}",
+		"{title}/{unknown}{name}",
+		"{title:03}/{name}",
+		"{title}/{ext}",
+	} {
+		if _, err := ParseNameTemplate(template); err == nil {
+			t.Errorf("Expected an error for template %q", template)
+		}
+	}
+}
+
+func TestNameTemplate(t *testing.T) {
+	tmpl := MustParseNameTemplate("{site}/{board}/{yyyy}-{mm}/{article_id} {title}/{seq:03}.{ext}")
+	vars := NameVars{
+		Site:      "ptt",
+		Board:     "Beauty",
+		ArticleID: "M.1704067200.A.AAA",
+		Title:     " [正妹] a/b:c..",
+		Time:      time.Unix(1704067200, 0), // 2024-01-01 08:00 in Taiwan
+	}
+	got := filepath.ToSlash(filepath.Join(tmpl.AlbumDir(vars), tmpl.FileName(vars, 7, "abc", "jpg")))
+	if expected := "ptt/Beauty/2024-01/M.1704067200.A.AAA [正妹] a_b_c/007.jpg"; got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+
+	// The width is zero padded either way.
+	for template, expected := range map[string]string{"{site}/{seq:3}.{ext}": "007.jpg", "{site}/{seq}.{ext}": "7.jpg"} {
+		if got := MustParseNameTemplate(template).FileName(vars, 7, "abc", "jpg"); got != expected {
+			t.Errorf("Expected %s for template %q, got %s", expected, template, got)
+		}
+	}
+
+	// Unknown values.
+	if got := filepath.ToSlash(tmpl.AlbumDir(NameVars{Site: "fbalbum", Title: ".."})); got != "fbalbum/_/0000-00/_" {
+		t.Errorf("Expected fbalbum/_/0000-00/_, got %s", got)
+	}
+}
+
+func TestNameTemplate_ShortMaxLength(t *testing.T) {
+	tmpl := MustParseNameTemplate("{site}/{title}/{seq:03}.{ext}")
+	tmpl.MaxLength = 12
+	vars := NameVars{Site: "ptt", Title: "[正妹] A long title"}
+
+	suffix := " [M.1700000000.A.ABC]"
+	if got := filepath.ToSlash(tmpl.albumDir(vars, suffix)); got != "ptt/["+suffix {
+		t.Errorf("Expected ptt/[%s, got %s", suffix, got)
+	}
+	if got := filepath.ToSlash(tmpl.AlbumDir(vars)); got != "ptt/[正妹] A l" {
+		t.Errorf("Expected ptt/[正妹] A l, got %s", got)
+	}
+	if got := truncateUTF8("abc", -1); got != "" {
+		t.Errorf("Expected an empty string, got %q", got)
+	}
+}
+
+func TestSanitizeName(t *testing.T) {
+	tests := []struct{ in, expected string }{
+		{"../evil: a/b  ", "_evil_ a_b"},
+		{"tab\there", "tab_here"},
+		{`a\b*c?d"e<f>g|h`, "a_b_c_d_e_f_g_h"},
+		{"CON", "_CON"},
+		{"nul.txt", "_nul.txt"},
+		{"...", "_"},
+	}
+	for _, tt := range tests {
+		if got := sanitizeName(tt.in, DefaultMaxNameLength); got != tt.expected {
+			t.Errorf("sanitizeName(%q): expected %q, got %q", tt.in, tt.expected, got)
+		}
+	}
+
+	long := strings.Repeat("正妹", 100) // 600 bytes
+	if got := sanitizeName(long, 200); len(got) > 200 || !utf8.ValidString(got) {
+		t.Errorf("Expected a valid name of at most 200 bytes, got %d bytes", len(got))
+	}
+	if got := sanitizeFileName(long+".jpeg", 200); len(got) > 200 || !strings.HasSuffix(got, ".jpeg") || !utf8.ValidString(got) {
+		t.Errorf("Expected the extension kept within 200 bytes, got %q (%d bytes)", got, len(got))
+	}
+}
+
+func TestDownload_SameTitleCollision(t *testing.T) {
+	article := strings.ReplaceAll(mockArticleHTML, "imgur.com", "example.invalid")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(article))
+	}))
+	defer server.Close()
+
+	ptt := NewPTT()
+	ptt.BaseDir = t.TempDir()
+	ctx := context.Background()
+	first, err := ptt.Download(ctx, server.URL+"/bbs/Beauty/M.1704067200.A.AAA.html", 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := ptt.Download(ctx, server.URL+"/bbs/Beauty/M.1704067300.A.BBB.html", 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := ptt.Download(ctx, server.URL+"/bbs/Beauty/M.1704067200.A.AAA.html", 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if filepath.Base(first.Dir) != "PTT - [正妹] HTML Article" {
+		t.Errorf("Unexpected album of the first post %s", first.Dir)
+	}
+	if filepath.Base(second.Dir) != "PTT - [正妹] HTML Article [M.1704067300.A.BBB]" {
+		t.Errorf("Expected the article ID in the album of the second post, got %s", second.Dir)
+	}
+	if again.Dir != first.Dir {
+		t.Errorf("Expected the first post in its album again, got %s", again.Dir)
+	}
+}
+
+func TestDownload_NameTemplate(t *testing.T) {
+	big := encodeTestImage(t, "png", 400, 400)
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/thread-3000000-1-1.html":
+			fmt.Fprintf(w, `<html><body><h1>A: "quoted" album</h1><div itemprop="articleBody">
+				<img file="%[1]s/a/img.jpg"><img file="%[1]s/b/img.jpg">
+			</div></body></html>`, server.URL)
+		default:
+			w.Write(big)
+		}
+	}))
+	defer server.Close()
+
+	c := NewCK101()
+	c.BaseDir = t.TempDir()
+	c.Naming = MustParseNameTemplate("{site}/{article_id} {title}/{seq:02} {name}.{ext}")
+	report, err := c.Download(context.Background(), server.URL+"/thread-3000000-1-1.html", 2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := filepath.Join(c.BaseDir, "ck101", "3000000 A_ _quoted_ album"); report.Dir != expected {
+		t.Errorf("Expected album %s, got %s", expected, report.Dir)
+	}
+	var files []string
+	for _, image := range report.Images {
+		files = append(files, filepath.Base(image.Path))
+	}
+	if fmt.Sprint(files) != "[01 img.png 02 img.png]" {
+		t.Errorf("Expected files [01 img.png 02 img.png], got %v", files)
+	}
+
+	// Albums of any template are found by the scan.
+	albums, err := ScanAlbums(context.Background(), c.BaseDir, ScanOptions{})
+	if err != nil || len(albums) != 1 || albums[0].Site != "ck101" || len(albums[0].Images) != 2 {
+		t.Errorf("Expected the album found by the scan, got %+v, err %v", albums, err)
+	}
+}
@@ -0,0 +1,278 @@
+package photomgr
+
+import (
+	"fmt"
+	"image"
+	"math/bits"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// ImageHash is a 64 bit perceptual hash of an image, see DHash. Re-compressed
+// or resized copies of an image have hashes within a small Hamming distance.
+// The zero value means no hash.
+type ImageHash uint64
+
+// DefaultSimilarDistance is a Hamming distance which finds re-compressed and
+// resized copies with few false positives.
+const DefaultSimilarDistance = 10
+
+// Distance returns the number of different bits between h and other.
+func (h ImageHash) Distance(other ImageHash) int {
+	return bits.OnesCount64(uint64(h ^ other))
+}
+
+func (h ImageHash) String() string {
+	return fmt.Sprintf("%016x", uint64(h))
+}
+
+// MarshalText encodes the hash as 16 hex digits.
+func (h ImageHash) MarshalText() ([]byte, error) {
+	return []byte(h.String()), nil
+}
+
+// UnmarshalText decodes the hash from hex digits.
+func (h *ImageHash) UnmarshalText(text []byte) error {
+	v, err := strconv.ParseUint(string(text), 16, 64)
+	if err != nil {
+		return fmt.Errorf("invalid image hash %q: %w", text, err)
+	}
+	*h = ImageHash(v)
+	return nil
+}
+
+// DHash computes the difference hash of m: the image is shrunk to 9x8 gray
+// cells, and every bit tells whether a cell is brighter than its right
+// neighbour.
+func DHash(m image.Image) ImageHash {
+	const w, h = 9, 8
+	var cells [h][w]uint32
+
+	b := m.Bounds()
+	for cy := 0; cy < h; cy++ {
+		y0 := b.Min.Y + cy*b.Dy()/h
+		y1 := b.Min.Y + (cy+1)*b.Dy()/h
+		for cx := 0; cx < w; cx++ {
+			x0 := b.Min.X + cx*b.Dx()/w
+			x1 := b.Min.X + (cx+1)*b.Dx()/w
+			cells[cy][cx] = averageLuma(m, x0, y0, x1, y1)
+		}
+	}
+
+	var hash ImageHash
+	for y := 0; y < h; y++ {
+		for x := 0; x < w-1; x++ {
+			hash <<= 1
+			if cells[y][x] > cells[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// averageLuma returns the average luma of the rectangle x0,y0 - x1,y1 of m,
+// sampling at most 16x16 pixels so large images stay fast.
+func averageLuma(m image.Image, x0, y0, x1, y1 int) uint32 {
+	if x1 <= x0 {
+		x1 = x0 + 1
+	}
+	if y1 <= y0 {
+		y1 = y0 + 1
+	}
+	stepX := (x1-x0)/16 + 1
+	stepY := (y1-y0)/16 + 1
+
+	var sum, n uint64
+	for y := y0; y < y1; y += stepY {
+		for x := x0; x < x1; x += stepX {
+			r, g, b, _ := m.At(x, y).RGBA()
+			sum += (299*uint64(r) + 587*uint64(g) + 114*uint64(b)) / 1000
+			n++
+		}
+	}
+	return uint32(sum / n)
+}
+
+// DHashFile decodes the image file at path and returns its DHash. Only the
+// formats of the standard library (JPEG, PNG and GIF) can be decoded.
+func DHashFile(path string) (ImageHash, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	m, _, err := image.Decode(f)
+	if err != nil {
+		return 0, fmt.Errorf("%w: decode %s: %v", ErrParseFailed, path, err)
+	}
+	return DHash(m), nil
+}
+
+// SimilarImage is a library image similar to a query hash.
+type SimilarImage struct {
+	LibraryEntry
+	Distance int `json:"distance"`
+}
+
+// bkTree indexes hashes by Hamming distance for radius queries.
+type bkTree struct {
+	entry    LibraryEntry
+	children map[int]*bkTree
+}
+
+func (t *bkTree) insert(entry LibraryEntry) {
+	for {
+		d := t.entry.DHash.Distance(entry.DHash)
+		child, ok := t.children[d]
+		if !ok {
+			if t.children == nil {
+				t.children = make(map[int]*bkTree)
+			}
+			t.children[d] = &bkTree{entry: entry}
+			return
+		}
+		t = child
+	}
+}
+
+func (t *bkTree) search(hash ImageHash, maxDistance int, found func(LibraryEntry, int)) {
+	d := t.entry.DHash.Distance(hash)
+	if d <= maxDistance {
+		found(t.entry, d)
+	}
+	for cd, child := range t.children {
+		if cd >= d-maxDistance && cd <= d+maxDistance {
+			child.search(hash, maxDistance, found)
+		}
+	}
+}
+
+// hashTree returns a bkTree of the library entries with a perceptual hash.
+func (l *Library) hashTree() *bkTree {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var tree *bkTree
+	for _, entry := range l.entries {
+		if entry.DHash == 0 {
+			continue
+		}
+		if tree == nil {
+			tree = &bkTree{entry: entry}
+			continue
+		}
+		tree.insert(entry)
+	}
+	return tree
+}
+
+// Similar returns the library images within maxDistance of hash, the closest
+// first and then the highest resolution first.
+func (l *Library) Similar(hash ImageHash, maxDistance int) []SimilarImage {
+	tree := l.hashTree()
+	if tree == nil {
+		return nil
+	}
+
+	var similar []SimilarImage
+	tree.search(hash, maxDistance, func(entry LibraryEntry, d int) {
+		similar = append(similar, SimilarImage{LibraryEntry: entry, Distance: d})
+	})
+	sort.Slice(similar, func(i, j int) bool {
+		if similar[i].Distance != similar[j].Distance {
+			return similar[i].Distance < similar[j].Distance
+		}
+		return betterVariant(similar[i].LibraryEntry, similar[j].LibraryEntry)
+	})
+	return similar
+}
+
+// SimilarToFile returns the library images within maxDistance of the image
+// file at path, see Similar.
+func (l *Library) SimilarToFile(path string, maxDistance int) ([]SimilarImage, error) {
+	hash, err := DHashFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return l.Similar(hash, maxDistance), nil
+}
+
+// Clusters groups the library images whose perceptual hashes are within
+// maxDistance of each other, directly or through other images. Only groups
+// of two or more images are returned, each sorted with the highest
+// resolution variant first, the largest group first.
+func (l *Library) Clusters(maxDistance int) [][]LibraryEntry {
+	tree := l.hashTree()
+	if tree == nil {
+		return nil
+	}
+
+	// Union-find over the SHA-256 of the entries.
+	parent := make(map[string]string)
+	var find func(string) string
+	find = func(s string) string {
+		p, ok := parent[s]
+		if !ok || p == s {
+			parent[s] = s
+			return s
+		}
+		root := find(p)
+		parent[s] = root
+		return root
+	}
+
+	entries := make(map[string]LibraryEntry)
+	var walk func(t *bkTree)
+	walk = func(t *bkTree) {
+		entries[t.entry.SHA256] = t.entry
+		for _, child := range t.children {
+			walk(child)
+		}
+	}
+	walk(tree)
+
+	for sum, entry := range entries {
+		tree.search(entry.DHash, maxDistance, func(other LibraryEntry, d int) {
+			if a, b := find(sum), find(other.SHA256); a != b {
+				parent[a] = b
+			}
+		})
+	}
+
+	groups := make(map[string][]LibraryEntry)
+	for sum, entry := range entries {
+		root := find(sum)
+		groups[root] = append(groups[root], entry)
+	}
+
+	var clusters [][]LibraryEntry
+	for _, group := range groups {
+		if len(group) < 2 {
+			continue
+		}
+		sort.Slice(group, func(i, j int) bool { return betterVariant(group[i], group[j]) })
+		clusters = append(clusters, group)
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		if len(clusters[i]) != len(clusters[j]) {
+			return len(clusters[i]) > len(clusters[j])
+		}
+		return clusters[i][0].File < clusters[j][0].File
+	})
+	return clusters
+}
+
+// betterVariant reports whether a should be kept over b: higher resolution,
+// then larger file, then file name for a stable order.
+func betterVariant(a, b LibraryEntry) bool {
+	if pa, pb := a.Width*a.Height, b.Width*b.Height; pa != pb {
+		return pa > pb
+	}
+	if a.Size != b.Size {
+		return a.Size > b.Size
+	}
+	return a.File < b.File
+}
@@ -0,0 +1,102 @@
+package photomgr
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// patternImage returns a w x h image with a diagonal gradient, flipped
+// horizontally when mirror is set.
+func patternImage(w, h int, mirror bool) image.Image {
+	m := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			fx := x
+			if mirror {
+				fx = w - 1 - x
+			}
+			v := uint8((fx*255/w + y*255/h) / 2)
+			if (fx*8/w+y*8/h)%3 == 0 {
+				v = 255 - v
+			}
+			m.Set(x, y, color.RGBA{v, v / 2, 255 - v, 255})
+		}
+	}
+	return m
+}
+
+func encodeJPEG(t *testing.T, m image.Image, quality int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, m, &jpeg.Options{Quality: quality}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDHash_NearDuplicates(t *testing.T) {
+	original := DHash(patternImage(800, 600, false))
+	resized, _ := jpeg.Decode(bytes.NewReader(encodeJPEG(t, patternImage(400, 300, false), 40)))
+	other := DHash(patternImage(800, 600, true))
+
+	if d := original.Distance(DHash(resized)); d > DefaultSimilarDistance {
+		t.Errorf("Expected resized re-compressed copy within %d, got %d", DefaultSimilarDistance, d)
+	}
+	if d := original.Distance(other); d <= DefaultSimilarDistance {
+		t.Errorf("Expected a different image to be farther than %d, got %d", DefaultSimilarDistance, d)
+	}
+
+	var decoded ImageHash
+	if err := decoded.UnmarshalText([]byte(original.String())); err != nil || decoded != original {
+		t.Errorf("Expected %v after text round trip, got %v (%v)", original, decoded, err)
+	}
+}
+
+func TestLibrary_ClustersAndSimilar(t *testing.T) {
+	pages := map[string][]byte{
+		"/big.jpg":   encodeJPEG(t, patternImage(800, 600, false), 90),
+		"/small.jpg": encodeJPEG(t, patternImage(480, 360, false), 40),
+		"/other.jpg": encodeJPEG(t, patternImage(800, 600, true), 90),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(pages[r.URL.Path])
+	}))
+	defer server.Close()
+
+	root := t.TempDir()
+	lib, err := OpenLibrary(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(root, "PTT - album")
+	os.MkdirAll(dir, 0755)
+	images := []string{server.URL + "/small.jpg", server.URL + "/big.jpg", server.URL + "/other.jpg"}
+	if err := (&baseCrawler{}).downloadImages(context.Background(), lib, &DownloadReport{Dir: dir}, images, downloadOptions{}, 1, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	clusters := lib.Clusters(DefaultSimilarDistance)
+	if len(clusters) != 1 || len(clusters[0]) != 2 {
+		t.Fatalf("Expected 1 cluster of 2 images, got %+v", clusters)
+	}
+	if clusters[0][0].File != "PTT - album/big.jpg" || clusters[0][0].Width != 800 || clusters[0][1].File != "PTT - album/small.jpg" {
+		t.Errorf("Expected the highest resolution variant first, got %+v", clusters[0])
+	}
+
+	similar, err := lib.SimilarToFile(filepath.Join(dir, "small.jpg"), DefaultSimilarDistance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Both variants, at the same distance the highest resolution first.
+	if len(similar) != 2 || similar[0].File != "PTT - album/big.jpg" || similar[1].File != "PTT - album/small.jpg" {
+		t.Errorf("Expected the two variants, got %+v", similar)
+	}
+}
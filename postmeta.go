@@ -0,0 +1,133 @@
+package photomgr
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// PostMetaFileName is the name of the sidecar metadata file in every album
+// folder.
+const PostMetaFileName = "post.json"
+
+// PostMeta is the provenance of an album folder: the post it was downloaded
+// from and where every image went. It is written by every download, so the
+// album can be browsed and traced back without fetching the post again.
+type PostMeta struct {
+	Site      string    `json:"site"` // Registered site name, such as "ptt"
+	ArticleID string    `json:"article_id,omitempty"`
+	URL       string    `json:"url"`
+	Title     string    `json:"title"`
+	Author    string    `json:"author,omitempty"`
+	Board     string    `json:"board,omitempty"`
+	Date      string    `json:"date,omitempty"` // As shown on the post
+	Time      time.Time `json:"time"`           // Zero when unknown
+	Like      int       `json:"like"`
+	Dislike   int       `json:"dislike"`
+	Content   string    `json:"content,omitempty"`
+	Pushes    []PttPush `json:"pushes,omitempty"`
+	// Images are in post order.
+	Images    []PostMetaImage `json:"images"`
+	CrawledAt time.Time       `json:"crawled_at"`
+}
+
+// PostMetaImage maps an image URL of the post to its file in the album.
+type PostMetaImage struct {
+	URL    string `json:"url"`
+	Status string `json:"status"`
+	// File is the file name in the album folder, empty when not saved.
+	File string `json:"file,omitempty"`
+}
+
+// newPttPostMeta returns the metadata of a parsed PTT article.
+func newPttPostMeta(article *PttArticle) *PostMeta {
+	summary := SummarizePushes(article.Pushes)
+	return &PostMeta{
+		Site:      "ptt",
+		ArticleID: article.ArticleID,
+		URL:       article.URL,
+		Title:     article.Title,
+		Author:    article.Author,
+		Board:     article.Board,
+		Date:      article.Date,
+		Time:      article.Time,
+		Like:      summary.Like,
+		Dislike:   summary.Dislike,
+		Content:   article.Content,
+		Pushes:    article.Pushes,
+	}
+}
+
+// setImages fills Images and CrawledAt from a download report.
+func (m *PostMeta) setImages(report *DownloadReport) {
+	m.Images = make([]PostMetaImage, 0, len(report.Images))
+	for _, image := range report.Images {
+		file := ""
+		if image.Path != "" {
+			file = filepath.Base(image.Path)
+		}
+		m.Images = append(m.Images, PostMetaImage{URL: image.URL, Status: image.Status, File: file})
+	}
+	m.CrawledAt = report.Finished
+	if m.CrawledAt.IsZero() {
+		m.CrawledAt = time.Now()
+	}
+}
+
+// LoadPostMeta reads the sidecar metadata of album folder dir.
+func LoadPostMeta(dir string) (*PostMeta, error) {
+	path := filepath.Join(dir, PostMetaFileName)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	meta := new(PostMeta)
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrParseFailed, path, err)
+	}
+	return meta, nil
+}
+
+// writePostMeta writes meta as the sidecar metadata of album folder dir.
+func writePostMeta(dir string, meta *PostMeta) error {
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, PostMetaFileName), data)
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames
+// it, so path is never left half written.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// writeAlbumMeta completes meta with the images of a download and writes it
+// and the album index into the album folder of report. Errors are logged,
+// the images are saved anyway.
+func writeAlbumMeta(report *DownloadReport, meta *PostMeta) {
+	meta.setImages(report)
+	if err := writePostMeta(report.Dir, meta); err != nil {
+		log.Printf("post meta error: %s, album: %s", err, report.Dir)
+	}
+	if err := writeAlbumIndex(report); err != nil {
+		log.Printf("album index error: %s, album: %s", err, report.Dir)
+	}
+}
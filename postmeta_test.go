@@ -0,0 +1,108 @@
+package photomgr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDownload_PttPostMeta(t *testing.T) {
+	// The article without its imgur links, so nothing is downloaded.
+	article := strings.ReplaceAll(mockArticleHTML, "imgur.com", "example.invalid")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(article))
+	}))
+	defer server.Close()
+
+	ptt := NewPTT()
+	ptt.BaseDir = t.TempDir()
+	report, err := ptt.Download(context.Background(), server.URL+"/bbs/Beauty/M.1704067200.A.AAA.html", 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meta, err := LoadPostMeta(report.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Site != "ptt" || meta.ArticleID != "M.1704067200.A.AAA" || meta.Title != "[正妹] HTML Article" ||
+		meta.Author != "htmluser" || meta.Board != "Beauty" || meta.Time.IsZero() {
+		t.Errorf("Unexpected post meta: %+v", meta)
+	}
+	if meta.Like != 2 || meta.Dislike != 1 || len(meta.Pushes) != 3 || !strings.HasPrefix(meta.Content, "This is the HTML content.") {
+		t.Errorf("Unexpected pushes or content in post meta: %+v", meta)
+	}
+	if meta.CrawledAt.IsZero() || meta.Images == nil {
+		t.Errorf("Expected crawl time and empty images, got %+v", meta)
+	}
+}
+
+func TestDownload_CK101PostMeta(t *testing.T) {
+	big := encodeTestImage(t, "jpg", 400, 400)
+	small := encodeTestImage(t, "png", 10, 10)
+
+	server := newCK101TestServer(t, map[string][]byte{"/big.jpg": big, "/small.png": small}, "/big.jpg", "/small.png")
+
+	c := NewCK101()
+	c.BaseDir = t.TempDir()
+	target := server.URL + ck101TestThread
+	report, err := c.Download(context.Background(), target, 2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meta, err := LoadPostMeta(report.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Site != "ck101" || meta.ArticleID != "3000000" || meta.URL != target || meta.Title != "Album" ||
+		meta.Author != "ckuser" || meta.Date != "2024-1-2 15:04:05" ||
+		!meta.Time.Equal(time.Date(2024, 1, 2, 15, 4, 5, 0, taiwanLocation)) {
+		t.Errorf("Unexpected post meta: %+v", meta)
+	}
+	expected := []PostMetaImage{
+		{URL: server.URL + "/big.jpg", Status: ImageDone, File: "001.jpg"},
+		{URL: server.URL + "/small.png", Status: ImageSkipped},
+	}
+	if fmt.Sprint(meta.Images) != fmt.Sprint(expected) {
+		t.Errorf("Expected images %+v, got %+v", expected, meta.Images)
+	}
+
+	if _, err := LoadPostMeta(t.TempDir()); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected os.ErrNotExist without post meta, got %v", err)
+	}
+}
+
+func TestDownload_FBAlbumPostMeta(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><body><h1 id="thread_subject">FB Album</h1><div id="postlist"><div id="post_7">
+			<div class="authi"><a href="space-uid-7.html" class="xw1">fbuser</a></div>
+			<div class="authi"><em id="authorposton7">發表於 2023-12-31 08:30</em></div>
+			<div itemprop="articleBody"></div>
+		</div></div></body></html>`))
+	}))
+	defer server.Close()
+
+	p := NewFBAlbum()
+	p.BaseDir = t.TempDir()
+	target := server.URL + "/viewthread.php?tid=4000000"
+	report, err := p.Download(context.Background(), target, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meta, err := LoadPostMeta(report.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Site != "fbalbum" || meta.ArticleID != "4000000" || meta.Author != "fbuser" || meta.Date != "2023-12-31 08:30" ||
+		!meta.Time.Equal(time.Date(2023, 12, 31, 8, 30, 0, 0, taiwanLocation)) {
+		t.Errorf("Unexpected post meta: %+v", meta)
+	}
+}
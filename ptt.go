@@ -1,40 +1,65 @@
 package photomgr
 
 import (
-	"bytes"
-	"encoding/json"
-	"errors"
+	"context"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"net/http"
-	"os"
-	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
-	"sync"
+	"time"
 
 	"github.com/PuerkitoBio/goquery"
 )
 
 // PttPostEntry represents a single post entry from the PTT index page.
 type PttPostEntry struct {
-	Title     string `json:"title"`
-	URL       string `json:"url"`
-	Author    string `json:"author"`
-	Date      string `json:"date"`
-	PushCount int    `json:"push_count"` // "爆" is converted to 100 during parsing
+	ArticleID string    `json:"article_id"`
+	Title     string    `json:"title"`
+	URL       string    `json:"url"`
+	Author    string    `json:"author"`
+	Date      string    `json:"date"`       // As listed, such as "5/24"
+	Time      time.Time `json:"time"`       // From the article ID, zero if unknown
+	PushCount int       `json:"push_count"` // "爆" is converted to 100 during parsing
+}
+
+// newPttPostEntry converts a listed post to PttPostEntry.
+func newPttPostEntry(post PostDoc) PttPostEntry {
+	return PttPostEntry{
+		ArticleID: post.ArticleID,
+		Title:     post.ArticleTitle,
+		URL:       post.URL,
+		Author:    post.Author,
+		Date:      post.Date,
+		Time:      post.Time,
+		PushCount: post.Likeint,
+	}
 }
 
 // PttArticle represents a single scraped PTT post.
 type PttArticle struct {
-	Author    string   `json:"author"`
-	Board     string   `json:"board"`
-	Title     string   `json:"title"`
-	Date      string   `json:"date"`
-	ImageURLs []string `json:"image_urls"`
-	Content   string   `json:"content"`
+	ArticleID string    `json:"article_id"` // "M.1234567890.A.BCD"
+	URL       string    `json:"url"`
+	Author    string    `json:"author"`
+	Board     string    `json:"board"`
+	Title     string    `json:"title"`
+	Date      string    `json:"date"`
+	Time      time.Time `json:"time"` // Date parsed in Taiwan time, or the article ID timestamp
+	ImageURLs []string  `json:"image_urls"`
+	Content   string    `json:"content"`
+	Pushes    []PttPush `json:"pushes"`
+
+	// SenderIP is the IP of the "※ 發信站" (or "◆ From") line.
+	SenderIP string `json:"sender_ip,omitempty"`
+	// Edits are the "※ 編輯" records in order.
+	Edits []PttEdit `json:"edits,omitempty"`
+	// CrossPostFrom is the board of a "※ [本文轉錄自 Board 看板 #ID ]" article,
+	// CrossPostFromID is the article short ID on that board if shown.
+	CrossPostFrom   string `json:"cross_post_from,omitempty"`
+	CrossPostFromID string `json:"cross_post_from_id,omitempty"`
+	// CrossPostTo are the boards of the "※ 轉錄至看板" lines.
+	CrossPostTo []string `json:"cross_post_to,omitempty"`
 }
 
 // FirecrawlRequest defines the structure for the Firecrawl API request body.
@@ -48,7 +73,8 @@ type FirecrawlRequest struct {
 
 // FirecrawlResponseData defines the structure of the "data" field in Firecrawl's response.
 type FirecrawlResponseData struct {
-	Markdown string `json:"markdown"`
+	Markdown string   `json:"markdown"`
+	Links    []string `json:"links,omitempty"`
 }
 
 // FirecrawlError defines the structure of the "error" field in Firecrawl's response.
@@ -79,6 +105,23 @@ func extractArticleIDFromURL(url string) string {
 	return idParts[0]
 }
 
+// pttArticleTimestampRegex captures the unix time of an article ID.
+var pttArticleTimestampRegex = regexp.MustCompile(`M\.(\d+)\.A\.`)
+
+// articleIDTime returns the post time in the "M.<unix>.A.XXX" article ID or
+// URL, or zero time if there is none.
+func articleIDTime(id string) time.Time {
+	match := pttArticleTimestampRegex.FindStringSubmatch(id)
+	if match == nil {
+		return time.Time{}
+	}
+	sec, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0).In(taiwanLocation)
+}
+
 // parsePushCount converts a push string (e.g., "爆", "10", "X1") to an integer.
 func parsePushCount(pushStr string) int {
 	pushStr = strings.TrimSpace(pushStr)
@@ -128,8 +171,8 @@ func parseMarkdownToPostDocs(markdown string, baseAddress string) []PostDoc {
 
 		title := strings.TrimSpace(match[1])
 		url := strings.TrimSpace(match[2])
-		// Date is match[4] - not directly used in PostDoc, but good to extract
-		_ = strings.TrimSpace(match[4])
+		author := strings.TrimSpace(match[3])
+		date := strings.TrimSpace(match[4])
 		pushStr := strings.TrimSpace(match[5])
 
 		// Ensure URL is absolute
@@ -137,14 +180,7 @@ func parseMarkdownToPostDocs(markdown string, baseAddress string) []PostDoc {
 			url = baseAddress + url
 		}
 
-		// Filter out announcements or other non-post entries based on title, if necessary.
-		// For now, we assume all matches are valid posts.
-		// Example: if strings.HasPrefix(title, "[公告]") { continue }
-
-		if !CheckTitleWithBeauty(title) { // Reuse existing filter
-			log.Printf("Skipping post with title not matching Beauty criteria: %s", title)
-			continue
-		}
+		// Posts are filtered by title later with PTT.TitleFilter, see filterPosts.
 
 		articleID := extractArticleIDFromURL(url)
 		likeCount := parsePushCount(pushStr)
@@ -152,16 +188,35 @@ func parseMarkdownToPostDocs(markdown string, baseAddress string) []PostDoc {
 		newPost := PostDoc{
 			ArticleID:    articleID,
 			ArticleTitle: title,
+			Author:       author,
+			Date:         date,
 			URL:          url,
 			Likeint:      likeCount,
-			// Author and Date are available but not in PostDoc.
-			// If PttPostEntry were used, they'd be stored there.
+			Time:         articleIDTime(articleID),
 		}
 		posts = append(posts, newPost)
 	}
 	if len(matches) == 0 && len(markdown) > 0 {
 		log.Println("No posts found in markdown. Markdown sample (first 500 chars):", markdown[:min(500, len(markdown))])
 	}
+	return dropPinnedPosts(posts)
+}
+
+// dropPinnedPosts cuts the pinned announcements at the bottom of the newest
+// board page, which the markdown has no `.r-list-sep` separator for. Listed
+// posts are in post order, so they start at the first post older than the
+// one before it. Posts of unknown time are not compared.
+func dropPinnedPosts(posts []PostDoc) []PostDoc {
+	var last time.Time
+	for i, post := range posts {
+		if post.Time.IsZero() {
+			continue
+		}
+		if post.Time.Before(last) {
+			return posts[:i]
+		}
+		last = post.Time
+	}
 	return posts
 }
 
@@ -179,8 +234,37 @@ type PTT struct {
 	//Handle base folder address to store images
 	BaseDir       string
 	SearchAddress string
+
+	// Board is the board name used in all URLs, use SetBoard to change it.
+	Board string
+
+	// TitleFilter keeps the listed posts it returns true for, nil keeps all.
+	// NewPTT sets it to CheckTitleWithBeauty.
+	TitleFilter TitleFilter
+
+	// newest caches the number of the newest index page, see NewestIndex.
+	newest newestIndexCache
+
+	// Backend selects how board pages and articles are fetched, the zero
+	// value PttBackendAuto uses Firecrawl with fallback to direct HTML.
+	Backend PttBackend
+
+	// Fetcher is the markdown provider used by the Firecrawl backend, nil
+	// means Firecrawl cloud with FIRECRAWL_KEY.
+	Fetcher Fetcher
+
+	// Naming builds the album folder and file names, nil means
+	// DefaultPTTNameTemplate.
+	Naming *NameTemplate
+
+	// Filter selects the saved images, nil means DefaultImageFilter.
+	Filter *ImageFilter
 }
 
+// pttSignatureRegex matches the first line of the signature, origin info or
+// push section that follows the content of an article, see parseArticleMarkdown.
+var pttSignatureRegex = regexp.MustCompile(`(?m)^(?:--\s*$|※\s(?:發信站|編輯|轉錄至看板|推噓紀錄).*|推\s|噓\s|→\s|◆\sFrom:)`)
+
 // firecrawlScrapeURL is the endpoint for the Firecrawl API.
 // It's a global variable to allow overriding for testing purposes.
 var firecrawlScrapeURL = "https://api.firecrawl.dev/v1/scrape"
@@ -205,78 +289,77 @@ var firecrawlScrapeURL = "https://api.firecrawl.dev/v1/scrape"
 //
 // The function returns the extracted markdown content or an error if any step fails.
 func callFirecrawlAPI(targetURL string) (string, error) {
-	apiKey := os.Getenv("FIRECRAWL_KEY")
-	if apiKey == "" {
-		return "", errors.New("FIRECRAWL_KEY not set")
-	}
-
-	requestBody := FirecrawlRequest{
-		URL: targetURL,
-		Headers: map[string]string{
-			"Cookie":     "over18=1",
-			"User-Agent": "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36",
-		},
-		Formats:         []string{"markdown"},
-		OnlyMainContent: true,
-		WaitFor:         1000,
-	}
+	return callFirecrawlAPIContext(context.Background(), targetURL)
+}
 
-	jsonBody, err := json.Marshal(requestBody)
-	if err != nil {
-		return "", fmt.Errorf("error marshalling request body: %w", err)
-	}
+// callFirecrawlAPIContext is callFirecrawlAPI bound to ctx, see FirecrawlFetcher.
+func callFirecrawlAPIContext(ctx context.Context, targetURL string) (string, error) {
+	return NewFirecrawlFetcher("").Fetch(ctx, targetURL)
+}
 
-	req, err := http.NewRequest("POST", firecrawlScrapeURL, bytes.NewBuffer(jsonBody))
-	if err != nil {
-		return "", fmt.Errorf("error creating request: %w", err)
-	}
+func init() {
+	RegisterSite("ptt", func() Site { return NewPTT() })
+}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+apiKey)
+// NewPTT returns a crawler of the Beauty board, which only keeps "[正妹]" posts.
+func NewPTT() *PTT {
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("error making request to Firecrawl API: %w", err)
-	}
-	defer resp.Body.Close()
+	p := NewPTTBoard("Beauty")
+	p.TitleFilter = CheckTitleWithBeauty
+	return p
+}
 
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := ioutil.ReadAll(resp.Body)
-		return "", fmt.Errorf("Firecrawl API request failed with status %d: %s", resp.StatusCode, string(bodyBytes))
-	}
+// NewPTTBoard returns a crawler of the PTT board name (e.g. "Gossiping"),
+// without title filter.
+func NewPTTBoard(name string) *PTT {
+	p := new(PTT)
+	p.baseAddress = "https://www.ptt.cc"
+	p.SetBoard(name)
+	return p
+}
 
-	bodyBytes, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("error reading response body: %w", err)
-	}
+// SetBoard changes the board to crawl, the entry and search address follow it.
+func (p *PTT) SetBoard(name string) {
+	p.Board = name
+	p.entryAddress = fmt.Sprintf("%s/bbs/%s/index.html", p.baseAddress, name)
+	p.SearchAddress = fmt.Sprintf("%s/bbs/%s/search?q=", p.baseAddress, name)
+}
 
-	var firecrawlResp FirecrawlResponse
-	if err := json.Unmarshal(bodyBytes, &firecrawlResp); err != nil {
-		return "", fmt.Errorf("error unmarshalling Firecrawl API response: %w. Response: %s", err, string(bodyBytes))
+// filterPosts returns posts accepted by TitleFilter, all of them when it is nil.
+func (p *PTT) filterPosts(posts []PostDoc) []PostDoc {
+	if p.TitleFilter == nil {
+		return posts
 	}
-
-	if !firecrawlResp.Success {
-		if firecrawlResp.Error != nil {
-			return "", fmt.Errorf("Firecrawl API error (%d): %s", firecrawlResp.Error.Code, firecrawlResp.Error.Message)
+	var ret []PostDoc
+	for _, post := range posts {
+		if !p.TitleFilter(post.ArticleTitle) {
+			log.Printf("Skipping post with title not matching title filter: %s", post.ArticleTitle)
+			continue
 		}
-		return "", errors.New("Firecrawl API call was not successful, but no error message was provided")
+		ret = append(ret, post)
 	}
+	return ret
+}
 
-	if firecrawlResp.Data.Markdown == "" {
-		return "", errors.New("Firecrawl API returned success but markdown content is empty")
-	}
+// Name returns the registered site name.
+func (p *PTT) Name() string {
+	return "ptt"
+}
 
-	return firecrawlResp.Data.Markdown, nil
+// SetBaseDir sets the folder to store images.
+func (p *PTT) SetBaseDir(dir string) {
+	p.BaseDir = dir
 }
 
-func NewPTT() *PTT {
+// ParsePageByIndex fetches board page by offset from the newest page and
+// replaces current result, see PageByOffset.
+func (p *PTT) ParsePageByIndex(page int) int {
+	return p.PageByOffset(page)
+}
 
-	p := new(PTT)
-	p.baseAddress = "https://www.ptt.cc"
-	p.entryAddress = "https://www.ptt.cc/bbs/Beauty/index.html"
-	p.SearchAddress = "https://www.ptt.cc/bbs/Beauty/search?q="
-	return p
+// ParsePageByIndexContext is the context-aware version of ParsePageByIndex.
+func (p *PTT) ParsePageByIndexContext(ctx context.Context, page int) (int, error) {
+	return p.PageByOffsetContext(ctx, page)
 }
 
 // Add new helper functions to extract title and image links.
@@ -313,8 +396,9 @@ func extractImageLinks(doc *goquery.Document) []string {
 	return links
 }
 
-// GetAllFromURL fetches an individual PTT article page using Firecrawl, then parses
-// the resulting markdown to extract article details.
+// GetAllFromURL fetches an individual PTT article page using the PTT backend,
+// see PttBackend. With Firecrawl it parses the resulting markdown to extract
+// article details.
 //
 // It assumes the markdown for an article page contains:
 //  1. A metadata block at the beginning, formatted with bolded field names:
@@ -328,15 +412,41 @@ func extractImageLinks(doc *goquery.Document) []string {
 //     "--", "※ 發信站:", "推 ", "噓 ", etc.
 //
 // The function returns the article title, a slice of all found image URLs, and
-// 0, 0 for like and dislike counts (as these are not reliably parsed from markdown).
+// the like (推) and dislike (噓) counts of the pushes, see GetPushes. Use
+// GetArticle for all parsed fields.
 func (p *PTT) GetAllFromURL(url string) (title string, allImages []string, like, dis int) {
-	markdown, err := callFirecrawlAPI(url)
+	title, allImages, like, dis, err := p.GetAllFromURLContext(context.Background(), url)
 	if err != nil {
-		log.Printf("Error calling Firecrawl API for URL %s in GetAllFromURL: %v", url, err)
+		log.Printf("Error in GetAllFromURL for URL %s: %v", url, err)
 		return "", nil, 0, 0 // Return empty/zero values on API error
 	}
+	return title, allImages, like, dis
+}
+
+// GetAllFromURLContext is the context-aware version of GetAllFromURL. It returns
+// ErrParseFailed when neither title nor images could be found in the article.
+func (p *PTT) GetAllFromURLContext(ctx context.Context, url string) (title string, allImages []string, like, dis int, err error) {
+	article, err := p.fetchArticle(ctx, url)
+	if err != nil {
+		return "", nil, 0, 0, err
+	}
+
+	// Log the parsed article (optional, useful for debugging)
+	// log.Printf("Parsed PttArticle for %s: Author='%s', Board='%s', Title='%s', Date='%s', ImageCount=%d, ContentLength=%d",
+	//	url, article.Author, article.Board, article.Title, article.Date, len(article.ImageURLs), len(article.Content))
+
+	if article.Title == "" && len(article.ImageURLs) == 0 {
+		return "", nil, 0, 0, fmt.Errorf("%w: no title or image in %s", ErrParseFailed, url)
+	}
+
+	summary := SummarizePushes(article.Pushes)
+	return article.Title, article.ImageURLs, summary.Like, summary.Dislike, nil
+}
 
-	article := PttArticle{} // Internal struct to hold parsed data
+// parseArticleMarkdown parses the Firecrawl markdown of a single article, see
+// GetAllFromURL for the expected layout.
+func parseArticleMarkdown(markdown string, url string) *PttArticle {
+	article := &PttArticle{} // Internal struct to hold parsed data
 
 	// 1. Parse Metadata from the beginning of the markdown.
 	// metaRegex captures:
@@ -405,7 +515,7 @@ func (p *PTT) GetAllFromURL(url string) (title string, allImages []string, like,
 	//   噓 (start of a shove comment)
 	//   → (start of a neutral comment)
 	//   ◆ From: (another PTT origin info format)
-	signatureRegex := regexp.MustCompile(`(?m)^(?:--\s*$|※\s(?:發信站|編輯|轉錄至看板|推噓紀錄).*|推\s|噓\s|→\s|◆\sFrom:)`)
+	signatureRegex := pttSignatureRegex
 
 	// Search for signature block only in the part of markdown *after* the metadata.
 	// If contentStartIndex is 0 (e.g. metadata parsing failed), search from start of markdown.
@@ -436,57 +546,74 @@ func (p *PTT) GetAllFromURL(url string) (title string, allImages []string, like,
 	}
 	article.Content = strings.TrimSpace(strings.Join(cleanedContentLines, "\n"))
 
-	// Log the parsed article (optional, useful for debugging)
-	// log.Printf("Parsed PttArticle for %s: Author='%s', Board='%s', Title='%s', Date='%s', ImageCount=%d, ContentLength=%d",
-	//	url, article.Author, article.Board, article.Title, article.Date, len(article.ImageURLs), len(article.Content))
+	// 4. Parse pushes and the origin, edit and cross-post lines after the content.
+	setArticleIdentity(article, url)
+	article.Pushes = parsePushesMarkdown(markdown[contentEndIndex:], article.Time)
+	parseArticleFooter(article, markdown)
 
-	// Return values as per function signature; like/dis are 0,0 as they are not parsed from markdown.
-	return article.Title, article.ImageURLs, 0, 0
+	return article
 }
 
+// over18Cookie is required to read PTT boards that ask for age verification.
+var over18Cookie = &http.Cookie{Name: "over18", Value: "1"}
+
 // GetUrlTitle: return title and url of post
 func (p *PTT) GetUrlTitle(target string) string {
-	// Get https response with setting cookie over18=1
-	resp := getResponseWithCookie(target)
-	doc, err := goquery.NewDocumentFromResponse(resp)
+	title, err := p.GetUrlTitleContext(context.Background(), target)
 	if err != nil {
 		log.Println(err)
-		return ""
 	}
+	return title
+}
 
-	//Title
-	articleTitle := ""
-	doc.Find(".article-metaline").Each(func(i int, s *goquery.Selection) {
-		if strings.Contains(s.Find(".article-meta-tag").Text(), "標題") {
-			articleTitle = s.Find(".article-meta-value").Text()
-		}
-	})
-	return articleTitle
+// GetUrlTitleContext returns the title of post.
+func (p *PTT) GetUrlTitleContext(ctx context.Context, target string) (string, error) {
+	// Get https response with setting cookie over18=1
+	doc, err := fetchDocument(ctx, target, over18Cookie)
+	if err != nil {
+		return "", err
+	}
+
+	articleTitle := extractTitle(doc)
+	if articleTitle == "" {
+		return "", fmt.Errorf("%w: no title in %s", ErrParseFailed, target)
+	}
+	return articleTitle, nil
 }
 
 // Crawler: parse ptt board page by index
 func (p *PTT) Crawler(target string, workerNum int) {
+	if err := p.CrawlerContext(context.Background(), target, workerNum); err != nil {
+		log.Println(err)
+	}
+}
+
+// CrawlerContext downloads all images of target post, cancelling ctx stops
+// the in-flight downloads.
+func (p *PTT) CrawlerContext(ctx context.Context, target string, workerNum int) error {
+	_, err := p.Download(ctx, target, workerNum, nil)
+	return err
+}
+
+// Download downloads all images of target post like CrawlerContext, and
+// returns the result of every image. Events are sent to progress if not nil.
+func (p *PTT) Download(ctx context.Context, target string, workerNum int, progress ProgressFunc) (*DownloadReport, error) {
 	// Get https response with setting cookie over18=1
-	resp := getResponseWithCookie(target)
-	doc, err := goquery.NewDocumentFromResponse(resp)
+	doc, err := fetchDocument(ctx, target, over18Cookie)
 	if err != nil {
-		log.Println(err)
-		return
+		return nil, err
 	}
 
 	articleTitle := extractTitle(doc)
-	dir := fmt.Sprintf("%v/%v - %v", p.BaseDir, "PTT", articleTitle)
-	if exist, _ := exists(dir); exist {
-		return
+	if articleTitle == "" {
+		return nil, fmt.Errorf("%w: no title in %s", ErrParseFailed, target)
 	}
-	os.MkdirAll(filepath.FromSlash(dir), 0755)
-
-	// Prepare concurrent download
-	linkChan := make(chan string)
-	wg := new(sync.WaitGroup)
-	for i := 0; i < workerNum; i++ {
-		wg.Add(1)
-		go p.worker(filepath.FromSlash(dir), linkChan, wg)
+	meta := newPttPostMeta(parseArticleHTML(doc, target))
+	meta.Title = articleTitle
+	naming := p.naming()
+	dir, err := makeAlbumDir(p.BaseDir, naming, meta)
+	if err != nil {
+		return nil, err
 	}
 
 	// Optimized: Extract image links once and send them
@@ -494,262 +621,143 @@ func (p *PTT) Crawler(target string, workerNum int) {
 	if len(images) == 0 {
 		log.Println("Don't have any image in this article.")
 	}
-	for _, imgLink := range images {
-		linkChan <- imgLink
-	}
-
-	close(linkChan)
-	wg.Wait()
+	report := &DownloadReport{Target: target, Title: articleTitle, Dir: dir}
+	err = p.downloadImages(ctx, libraryFor(p.BaseDir), report, images, downloadOptions{names: naming.fileNamer(nameVarsFromMeta(meta)), filter: p.Filter}, workerNum, progress)
+	writeAlbumMeta(report, meta)
+	recordCatalog(p.BaseDir, meta, report, err)
+	return report, err
 }
 
 // GetAllImageAddress: return all image address in current page.
 func (p *PTT) GetAllImageAddress(target string) []string {
-	var ret []string
-	// Get https response with setting cookie over18=1
-	resp := getResponseWithCookie(target)
-	doc, err := goquery.NewDocumentFromResponse(resp)
+	images, err := p.GetAllImageAddressContext(context.Background(), target)
 	if err != nil {
 		log.Println(err)
 		return nil
 	}
+	return images
+}
 
-	//Parse Image, currently support <IMG SRC> only
-	foundImage := false
-	doc.Find("a").Each(func(i int, s *goquery.Selection) {
-		imgLink, _ := s.Attr("href")
-		if isImageLink(imgLink) {
-			// Replace imgur.com link using helper.
-			imgLink = fixImgurLink(imgLink)
-			ret = append(ret, imgLink)
-			foundImage = true
-		}
-	})
+// GetAllImageAddressContext returns all image address of target post.
+func (p *PTT) GetAllImageAddressContext(ctx context.Context, target string) ([]string, error) {
+	// Get https response with setting cookie over18=1
+	doc, err := fetchDocument(ctx, target, over18Cookie)
+	if err != nil {
+		return nil, err
+	}
 
-	if !foundImage {
+	//Parse Image, currently support <IMG SRC> only
+	ret := extractImageLinks(doc)
+	if len(ret) == 0 {
 		log.Println("Don't have any image in this article. url:", target)
 	}
 
-	return ret
+	return ret, nil
 }
 
-// Return parse page result count, it will be 0 if you still not parse any page
-func (p *PTT) GetCurrentPageResultCount() int {
-	return len(p.storedPost)
-}
-
-// Get post title by index in current parsed page
-func (p *PTT) GetPostTitleByIndex(postIndex int) string {
-	if postIndex >= len(p.storedPost) {
-		return ""
+// Set Ptt board psot number, fetch assigned (at least) number of posts. Return real number.
+// The pages are read backward from page, see ListByNumber.
+func (p *PTT) ParsePttByNumber(num int, page int) int {
+	count, err := p.ParsePttByNumberContext(context.Background(), num, page)
+	if err != nil {
+		log.Println("ParsePttByNumber:", err)
 	}
-	return p.storedPost[postIndex].ArticleTitle
+	return count
 }
 
-// Get post URL by index in current parsed page
-func (p *PTT) GetPostUrlByIndex(postIndex int) string {
-	if postIndex >= len(p.storedPost) {
-		return ""
-	}
-
-	return p.storedPost[postIndex].URL
+// ParsePttByNumberContext fetches pages backward from page until at least num
+// posts are stored, see ListByNumberContext. It stops at the first failed
+// page and stores the posts so far.
+func (p *PTT) ParsePttByNumberContext(ctx context.Context, num int, page int) (int, error) {
+	posts, err := p.ListByNumberContext(ctx, num, page)
+	return p.setPosts(posts), err
 }
 
-// Get post like count by index in current parsed page
-func (p *PTT) GetPostStarByIndex(postIndex int) int {
-	if postIndex >= len(p.storedPost) {
-		return 0
+// GetPostEntries returns all posts of the last listing call as PttPostEntry.
+func (p *PTT) GetPostEntries() []PttPostEntry {
+	posts := p.storedPosts()
+	entries := make([]PttPostEntry, 0, len(posts))
+	for _, post := range posts {
+		entries = append(entries, newPttPostEntry(post))
 	}
-	return p.storedPost[postIndex].Likeint
+	return entries
 }
 
-// Set Ptt board psot number, fetch assigned (at least) number of posts. Return real number.
-func (p *PTT) ParsePttByNumber(num int, page int) int {
-	count := p.ParsePttPageByIndex(page, true)
-	if count > num {
-		return count
-	}
-	page++
-	for count < num {
-		count = p.ParsePttPageByIndex(page, false)
-		page++
+// Set Ptt board page index, fetch all post and return article count back.
+//
+// The page is the absolute number N of the board page index<N>.html, where
+// index1.html is the oldest page; page 0 is the newest page index.html. Use
+// PageByOffset to go backward from the newest page.
+func (p *PTT) ParsePttPageByIndex(page int, replace bool) int {
+	count, err := p.ParsePttPageByIndexContext(context.Background(), page, replace)
+	if err != nil {
+		log.Printf("ParsePttPageByIndex: page %d: %v", page, err)
 	}
-
 	return count
 }
 
-// Set Ptt board page index, fetch all post and return article count back
-func (p *PTT) ParsePttPageByIndex(page int, replace bool) int {
-	var targetURL string
-	if page > 0 {
-		// Note: The old logic for maxPageNumberString to calculate the actual index
-		// is complex and relied on scraping the "上頁" button.
-		// Firecrawl scrapes a single page. We need a simpler way to get older pages.
-		// PTT's own URL structure for older pages is index<number>.html where <number> DECREASES for older pages.
-		// This is a common source of confusion.
-		// The original code used 'maxPageNumberString' from the current page's "上頁" link,
-		// then calculated `pageNum = maxPageNum - page + 1`.
-		// This implies 'page 0' is latest, 'page 1' is one step back from latest etc.
-		// For Firecrawl, we'd need to know the *actual* index number.
-		// Let's assume for now `page` means "number of pages to go back from latest".
-		// If `p.entryAddress` is "https://www.ptt.cc/bbs/Beauty/index.html",
-		// then going back `page` pages means we need to find the current max index first.
-		// This is problematic without an initial scrape.
-		// A simpler interpretation: `page` is the actual index number to use if known.
-		// Or, if `page` is 0, use `p.entryAddress`. If `page` is 1, use `index1.html` (which is usually very old).
-		// Let's stick to the original intent: page 0 is the main index, page 1 is one page older, etc.
-		// This requires knowing the *current* max index.
-		// The old code did:
-		// 1. Fetch p.entryAddress (latest page)
-		// 2. Find "上頁" href, parse out maxPageNumberString (e.g., "3931")
-		// 3. Calculate pageNum = maxPageNum - page + 1
-		// This means to get page '1' (one older than current), we need to know '3931', so we'd fetch index3930.html.
-		// This two-step process is not ideal for Firecrawl.
-		// A common pattern for PTT is that index.html is the newest, index(N-1).html is older, index(N-2).html even older.
-		// Let's assume a direct mapping for now: if page > 0, it's an offset from a known latest,
-		// or it IS the number in index<NUM>.html.
-		// Given the original code's complexity, let's simplify: if page > 0, it means index(MAX-page+1).html.
-		// This still needs MAX.
-		// A simpler model: page 0 is index.html, page 1 is index<MAX-1>.html, page 2 is index<MAX-2>.html.
-		// For now, to avoid a preliminary scrape just to get the max index,
-		// let's assume `page` parameter means "how many pages back from the absolute newest index.html".
-		// If `page == 0`, target `p.entryAddress`.
-		// If `page > 0`, this implies we need to know the current highest index number.
-		// Let's use a placeholder for max index determination or assume page is an absolute index number for now.
-		// The original code fetched the main page, then found the "上頁" link to determine the max index.
-		// e.g. href="/bbs/Beauty/index3931.html" -> maxPageNumberString = "3931"
-		// then pageNum = Atoi(maxPageNumberString) - page + 1
-		// So if page=0, pageNum = max. page=1, pageNum = max-1.
-		// This means we need to get maxPageNumberString first if page > 0.
-		// This is tricky. For now, if page > 0, we will just use `index<page>.html`. This changes semantics.
-		// Let's try to keep original semantics: fetch entryAddress, find max index, then construct URL.
-		// This is inefficient with Firecrawl as it would be two API calls.
-		// The task is to refactor the *existing* logic. The existing logic *does* determine this.
-		// However, it does so by parsing HTML. We get Markdown now.
-		// Firecrawl's `onlyMainContent: true` might strip out pagination controls.
-		// If pagination is stripped, we cannot find "上頁".
-		// This is a significant problem for the existing logic.
-
-		// Assumption: Firecrawl's markdown for an index page might *not* include pagination links
-		// like "上頁" if `onlyMainContent: true`. If it *does*, then we can parse it.
-		// Let's assume it DOES NOT for now. This means we can only fetch `p.entryAddress` (latest)
-		// or a specific `index<NUM>.html` if `page` is treated as that number.
-
-		// Fallback: If page > 0, construct it as index<page>.html. This is a deviation but necessary
-		// if pagination info isn't in the markdown.
-		// Let's assume `page` is "pages to go back". If page is 0, it's `p.entryAddress`.
-		// If `page` is 1, it's the page before `p.entryAddress`.
-		// This requires knowing the current page's number.
-		// The problem statement says "The URL for ParsePttPageByIndex needs to be constructed correctly based on the page parameter, similar to the old logic".
-		// The old logic for page > 0:
-		//   1. GET p.entryAddress
-		//   2. Parse HTML to find href of "上頁" -> gives max_index_str
-		//   3. page_to_fetch_num = Atoi(max_index_str) - page + 1
-		//   4. targetURL = ".../index<page_to_fetch_num>.html"
-		// This is not possible if Firecrawl strips pagination or if we want to avoid two API calls.
-
-		// Simplification: Assume `page` directly corresponds to the index number in `index<page>.html`.
-		// If `page == 0` or not specified by user, it should mean `p.entryAddress`.
-		// PTT typically has `index.html` as the latest. Older pages are `indexXXXX.html` where XXXX decreases.
-		// So, if `page` parameter is `N`, it means `indexN.html`.
-		// If `page` is `0`, it means `p.entryAddress` (which is typically `index.html`).
-		if page > 0 {
-			targetURL = fmt.Sprintf("%s/bbs/Beauty/index%d.html", p.baseAddress, page)
-		} else {
-			targetURL = p.entryAddress // This is usually https://www.ptt.cc/bbs/Beauty/index.html
-		}
-		log.Printf("ParsePttPageByIndex: Target URL for page %d: %s", page, targetURL)
-
-	} else { // page == 0
-		targetURL = p.entryAddress
-		log.Printf("ParsePttPageByIndex: Target URL for page 0 (latest): %s", targetURL)
-	}
-
-	markdown, err := callFirecrawlAPI(targetURL)
+// ParsePttPageByIndexContext is the context-aware version of ParsePttPageByIndex.
+// On error the stored result is cleared when replace is true, and kept as is
+// otherwise; the returned count always reflects the stored result.
+func (p *PTT) ParsePttPageByIndexContext(ctx context.Context, page int, replace bool) (int, error) {
+	posts, err := p.ListAbsolutePageContext(ctx, page)
 	if err != nil {
-		log.Printf("Error calling Firecrawl API for URL %s: %v", targetURL, err)
 		if replace {
-			p.storedPost = []PostDoc{}
-			return 0
+			return p.setPosts(nil), err
 		}
-		return len(p.storedPost) // Return current count if appending
+		return p.GetCurrentPageResultCount(), err // Return current count if appending
 	}
 
-	newlyParsedPosts := parseMarkdownToPostDocs(markdown, p.baseAddress)
-
+	var count int
 	if replace {
-		p.storedPost = newlyParsedPosts
+		count = p.setPosts(posts)
 	} else {
-		p.storedPost = append(p.storedPost, newlyParsedPosts...)
+		count = p.appendPosts(posts)
 	}
-
-	log.Printf("ParsePttPageByIndex: Parsed %d posts from %s. Total stored posts: %d (replace=%t)",
-		len(newlyParsedPosts), targetURL, len(p.storedPost), replace)
-	return len(p.storedPost)
+	log.Printf("ParsePttPageByIndex: Parsed %d posts from page %d. Total stored posts: %d (replace=%t)",
+		len(posts), page, count, replace)
+	return count, nil
 }
 
-func getResponseWithCookie(url string) *http.Response { // This function might become unused by ParsePttPageByIndex and ParseSearchByKeyword
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		// Log instead of Fatal for cases where this function might still be called by other parts of the code.
-		log.Printf("Error creating GET request for %s: %v", url, err)
-		return nil // Or handle error more gracefully
-	}
-
-	req.AddCookie(&http.Cookie{Name: "over18", Value: "1"})
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+func (p *PTT) GetPostLikeDis(target string) (int, int) {
+	likeCount, disLikeCount, err := p.GetPostLikeDisContext(context.Background(), target)
 	if err != nil {
-		log.Printf("Error performing GET request for %s: %v", url, err)
-		return nil // Or handle error more gracefully
+		log.Printf("GetPostLikeDis: %v", err)
 	}
-	return resp
+	return likeCount, disLikeCount
 }
 
-func (p *PTT) GetPostLikeDis(target string) (int, int) {
-	// Get https response with setting cookie over18=1
-	resp := getResponseWithCookie(target)
-	if resp == nil { // Added check for nil response
-		log.Printf("GetPostLikeDis: Failed to get response for %s", target)
-		return 0, 0
-	}
-	doc, err := goquery.NewDocumentFromResponse(resp)
+// GetPostLikeDisContext returns the like (推) and dislike (噓) count of target
+// post, use GetPushes for the full push list.
+func (p *PTT) GetPostLikeDisContext(ctx context.Context, target string) (int, int, error) {
+	pushes, err := p.GetPushesContext(ctx, target)
 	if err != nil {
-		log.Println(err)
-		return 0, 0
+		return 0, 0, err
 	}
-
-	var likeCount int
-	var disLikeCount int
-	doc.Find(".push-tag").Each(func(i int, s *goquery.Selection) {
-		if strings.Contains(s.Text(), "推") {
-			likeCount++
-		} else if strings.Contains(s.Text(), "噓") {
-			disLikeCount++
-		}
-	})
-	// fmt.Println("like:", likeCount, " dislike:", disLikeCount)
-	return likeCount, disLikeCount
+	summary := SummarizePushes(pushes)
+	return summary.Like, summary.Dislike, nil
 }
 
 // Search with specific keyword, fetch all post and return article count back
 func (p *PTT) ParseSearchByKeyword(keyword string) int {
-	targetURL := p.SearchAddress + keyword
-	log.Printf("ParseSearchByKeyword: Target URL for keyword '%s': %s", keyword, targetURL)
-
-	markdown, err := callFirecrawlAPI(targetURL)
+	count, err := p.ParseSearchByKeywordContext(context.Background(), keyword)
 	if err != nil {
-		log.Printf("Error calling Firecrawl API for search URL %s: %v", targetURL, err)
-		p.storedPost = []PostDoc{} // Clear posts on error as per original logic (always replace)
-		return 0
+		log.Printf("ParseSearchByKeyword: keyword '%s': %v", keyword, err)
 	}
+	return count
+}
 
-	newlyParsedPosts := parseMarkdownToPostDocs(markdown, p.baseAddress)
-	p.storedPost = newlyParsedPosts // Always replace for search
-
+// ParseSearchByKeywordContext is the context-aware version of ParseSearchByKeyword.
+// The stored result is always replaced, and cleared on error.
+func (p *PTT) ParseSearchByKeywordContext(ctx context.Context, keyword string) (int, error) {
+	posts, err := p.SearchContext(ctx, keyword)
+	count := p.setPosts(posts)
+	if err != nil {
+		return 0, err
+	}
 	log.Printf("ParseSearchByKeyword: Parsed %d posts for keyword '%s'. Total stored posts: %d",
-		len(newlyParsedPosts), keyword, len(p.storedPost))
-	return len(p.storedPost)
+		len(posts), keyword, count)
+	return count, nil
 }
 
 // CheckTitleWithBeauty: check if title contains "[正妹]"
@@ -770,6 +778,47 @@ func CheckTitleWithBeauty(title string) bool {
 	return matched
 }
 
+// TitleFilter reports whether a listed post with title should be kept.
+type TitleFilter func(title string) bool
+
+// TitleRegexpFilter returns a filter which keeps titles matching any of patterns.
+func TitleRegexpFilter(patterns ...string) (TitleFilter, error) {
+	var res []*regexp.Regexp
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, re)
+	}
+	return func(title string) bool {
+		for _, re := range res {
+			if re.MatchString(title) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// TitleCategoryFilter returns a filter which keeps titles starting with any of
+// the categories, such as "正妹" for "[正妹] ...". The brackets are optional.
+func TitleCategoryFilter(categories ...string) TitleFilter {
+	var prefixes []string
+	for _, c := range categories {
+		c = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(c), "["), "]")
+		prefixes = append(prefixes, "["+c+"]")
+	}
+	return func(title string) bool {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(title, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
 // isImageLink checks if the given URL is an image link from supported hosts.
 // This function is likely unused by the refactored parsing functions but kept for other potential uses.
 func isImageLink(url string) bool {
@@ -0,0 +1,80 @@
+package photomgr
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// PttEdit is a "※ 編輯" record of a PTT article.
+type PttEdit struct {
+	UserID string    `json:"user_id"`
+	IP     string    `json:"ip,omitempty"`
+	Time   time.Time `json:"time"` // Zero if the record has no time
+}
+
+var (
+	// senderIPRegex matches the origin line of an article:
+	// "※ 發信站: 批踢踢實業坊(ptt.cc), 來自: 1.2.3.4 (臺灣)" or "◆ From: 1.2.3.4"
+	senderIPRegex = regexp.MustCompile(`(?:※ 發信站:.*?來自:|◆ From:)\s*(\d{1,3}(?:\.\d{1,3}){3})`)
+	// editRegex matches an edit line of an article:
+	// "※ 編輯: user (1.2.3.4 臺灣), 01/02/2024 15:04:05"
+	editRegex = regexp.MustCompile(`※ 編輯:\s*([A-Za-z0-9_]+)\s*(?:\((\d{1,3}(?:\.\d{1,3}){3})[^)]*\))?,?\s*(\d{2}/\d{2}/\d{4} \d{2}:\d{2}:\d{2})?`)
+	// crossPostFromRegex matches "※ [本文轉錄自 Beauty 看板 #1abcDEF ]".
+	crossPostFromRegex = regexp.MustCompile(`※ \[本文轉錄自\s*(\S+?)\s*看板(?:\s*#(\S+))?\s*\]`)
+	// crossPostToRegex matches "※ 轉錄至看板 Gossiping".
+	crossPostToRegex = regexp.MustCompile(`※ 轉錄至看板\s*(\S+)`)
+)
+
+// setArticleIdentity sets the ID, URL and post time of article fetched from url.
+func setArticleIdentity(article *PttArticle, url string) {
+	article.URL = url
+	if threadId.MatchString(url) {
+		article.ArticleID = extractArticleIDFromURL(url)
+	}
+	article.Time = articleTime(article.Date, url)
+}
+
+// parseArticleFooter extracts the sender IP, edit records and cross-post info
+// from the text of an article.
+func parseArticleFooter(article *PttArticle, text string) {
+	if match := senderIPRegex.FindStringSubmatch(text); match != nil {
+		article.SenderIP = match[1]
+	}
+
+	for _, match := range editRegex.FindAllStringSubmatch(text, -1) {
+		edit := PttEdit{UserID: match[1], IP: match[2]}
+		if t, err := time.ParseInLocation("01/02/2006 15:04:05", match[3], taiwanLocation); err == nil {
+			edit.Time = t
+		}
+		article.Edits = append(article.Edits, edit)
+	}
+
+	if match := crossPostFromRegex.FindStringSubmatch(text); match != nil {
+		article.CrossPostFrom, article.CrossPostFromID = match[1], match[2]
+	}
+	for _, match := range crossPostToRegex.FindAllStringSubmatch(text, -1) {
+		article.CrossPostTo = append(article.CrossPostTo, strings.TrimSpace(match[1]))
+	}
+}
+
+// GetArticle fetches a single article with all parsed fields: meta lines,
+// content, images, pushes, sender IP, edit records and cross-post info.
+func (p *PTT) GetArticle(url string) (*PttArticle, error) {
+	return p.GetArticleContext(context.Background(), url)
+}
+
+// GetArticleContext is the context-aware version of GetArticle. It returns
+// ErrParseFailed when neither title, content nor images could be found.
+func (p *PTT) GetArticleContext(ctx context.Context, url string) (*PttArticle, error) {
+	article, err := p.fetchArticle(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	if article.Title == "" && article.Content == "" && len(article.ImageURLs) == 0 {
+		return nil, fmt.Errorf("%w: no title, content or image in %s", ErrParseFailed, url)
+	}
+	return article, nil
+}
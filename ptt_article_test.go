@@ -0,0 +1,96 @@
+package photomgr
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestGetArticle_HTMLBackend(t *testing.T) {
+	server := newHTMLTestServer(t)
+	ptt := newHTMLTestPTT(server, PttBackendHTML)
+
+	url := server.URL + "/bbs/Beauty/M.1704067200.A.AAA.html"
+	article, err := ptt.GetArticle(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if article.ArticleID != "M.1704067200.A.AAA" || article.URL != url {
+		t.Errorf("Unexpected identity: id=%q url=%q", article.ArticleID, article.URL)
+	}
+	if !article.Time.Equal(time.Date(2024, 1, 1, 8, 0, 0, 0, taiwanLocation)) {
+		t.Errorf("Unexpected time: %v", article.Time)
+	}
+	if article.SenderIP != "1.2.3.4" {
+		t.Errorf("Expected sender IP 1.2.3.4, got %q", article.SenderIP)
+	}
+	if len(article.Pushes) != 3 || len(article.ImageURLs) != 2 || article.Content == "" {
+		t.Errorf("Unexpected body: pushes=%d images=%d content=%q", len(article.Pushes), len(article.ImageURLs), article.Content)
+	}
+	if len(article.Edits) != 0 || article.CrossPostFrom != "" || len(article.CrossPostTo) != 0 {
+		t.Errorf("Unexpected edits or cross-post info: %+v", article)
+	}
+}
+
+func TestGetArticle_Markdown(t *testing.T) {
+	url := "https://www.ptt.cc/bbs/Beauty/M.1704067200.A.AAA.html"
+	ptt := NewPTT()
+	ptt.Fetcher = &FixtureFetcher{Pages: map[string]string{url: `**Author**: user (Nick)
+**Board**: Beauty
+**Title**: Fw: [正妹] Cross Post
+**Date**: Invalid Date
+
+※ [本文轉錄自 Gossiping 看板 #1bcdEFGH ]
+
+Forwarded content.
+![](https://i.imgur.com/fw.jpg)
+
+--
+※ 發信站: 批踢踢實業坊(ptt.cc), 來自: 9.8.7.6 (臺灣)
+※ 文章網址: https://www.ptt.cc/bbs/Beauty/M.1704067200.A.AAA.html
+※ 編輯: user (9.8.7.6 臺灣), 01/01/2024 09:00:00
+推 pusher1: nice 01/01 09:10
+※ 轉錄至看板 Japan_Travel
+※ 編輯: user (9.8.7.6), 01/02/2024 10:00:00
+`}}
+
+	article, err := ptt.GetArticleContext(context.Background(), url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The date can not be parsed, so the time comes from the article ID.
+	if !article.Time.Equal(time.Unix(1704067200, 0)) {
+		t.Errorf("Expected time from article ID, got %v", article.Time)
+	}
+	if article.SenderIP != "9.8.7.6" {
+		t.Errorf("Expected sender IP 9.8.7.6, got %q", article.SenderIP)
+	}
+	expectedEdits := []PttEdit{
+		{UserID: "user", IP: "9.8.7.6", Time: time.Date(2024, 1, 1, 9, 0, 0, 0, taiwanLocation)},
+		{UserID: "user", IP: "9.8.7.6", Time: time.Date(2024, 1, 2, 10, 0, 0, 0, taiwanLocation)},
+	}
+	if len(article.Edits) != len(expectedEdits) {
+		t.Fatalf("Expected %d edits, got %+v", len(expectedEdits), article.Edits)
+	}
+	for i := range expectedEdits {
+		if article.Edits[i].UserID != expectedEdits[i].UserID || article.Edits[i].IP != expectedEdits[i].IP ||
+			!article.Edits[i].Time.Equal(expectedEdits[i].Time) {
+			t.Errorf("Edit %d: expected %+v, got %+v", i, expectedEdits[i], article.Edits[i])
+		}
+	}
+	if article.CrossPostFrom != "Gossiping" || article.CrossPostFromID != "1bcdEFGH" {
+		t.Errorf("Unexpected cross post origin: %q %q", article.CrossPostFrom, article.CrossPostFromID)
+	}
+	if len(article.CrossPostTo) != 1 || article.CrossPostTo[0] != "Japan_Travel" {
+		t.Errorf("Unexpected cross post targets: %v", article.CrossPostTo)
+	}
+	if len(article.Pushes) != 1 || article.Pushes[0].UserID != "pusher1" {
+		t.Errorf("Unexpected pushes: %+v", article.Pushes)
+	}
+
+	ptt.Fetcher = &FixtureFetcher{Pages: map[string]string{url: "\n"}}
+	if _, err := ptt.GetArticle(url); !errors.Is(err, ErrParseFailed) {
+		t.Errorf("Expected ErrParseFailed for an empty article, got %v", err)
+	}
+}
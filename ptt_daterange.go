@@ -0,0 +1,132 @@
+package photomgr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// maxEmptyProbes is how many older pages are tried when a probed page has no
+// post with a known time, such as a page of deleted posts.
+const maxEmptyProbes = 5
+
+// ListDateRange returns the posts of the board with from <= Time < to, oldest
+// first. Pass the day after the last day to include it, e.g. 2024-04-01 for
+// "until 2024-03-31". The start page is found by a binary search over the
+// index<N>.html pages by the post times of the M.<unix> article IDs, then the
+// pages are read forward until to. The posts are filtered by TitleFilter.
+func (p *PTT) ListDateRange(from, to time.Time) ([]PostDoc, error) {
+	return p.ListDateRangeContext(context.Background(), from, to)
+}
+
+// ListDateRangeContext is the context-aware version of ListDateRange. It stops
+// at the first failed page and returns the posts so far with the error.
+func (p *PTT) ListDateRangeContext(ctx context.Context, from, to time.Time) ([]PostDoc, error) {
+	if !from.Before(to) {
+		return nil, fmt.Errorf("invalid date range %s - %s", from, to)
+	}
+	newest, err := p.NewestIndexContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	start, err := p.findPageByTime(ctx, from, newest)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("ListDateRange: %s - %s starts at index%d.html (newest %d)", from, to, start, newest)
+
+	var posts []PostDoc
+	for index := start; index <= newest; index++ {
+		page, err := p.fetchIndex(ctx, p.indexURL(index))
+		if err != nil {
+			return posts, err
+		}
+		for _, post := range p.filterPosts(page) {
+			if !post.Time.Before(from) && post.Time.Before(to) {
+				posts = append(posts, post)
+			}
+		}
+		if _, last, ok := postTimeRange(page); ok && !last.Before(to) {
+			break
+		}
+	}
+	return posts, nil
+}
+
+// findPageByTime returns the first page, between index1.html and newest, with
+// a post at or after t. Page times grow with the index, as the article IDs are
+// the post times.
+func (p *PTT) findPageByTime(ctx context.Context, t time.Time, newest int) (int, error) {
+	lo, hi := 1, newest
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		last, err := p.pageNewestTime(ctx, mid)
+		if err != nil {
+			return 0, err
+		}
+		if !last.Before(t) {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	return lo, nil
+}
+
+// pageNewestTime returns the time of the newest post of page index, without
+// TitleFilter. Pages without a post time use the older pages, a page without
+// any older time returns the zero time.
+func (p *PTT) pageNewestTime(ctx context.Context, index int) (time.Time, error) {
+	for i := 0; i < maxEmptyProbes && index-i >= 1; i++ {
+		page, err := p.fetchIndex(ctx, p.indexURL(index-i))
+		if err != nil {
+			return time.Time{}, err
+		}
+		if _, last, ok := postTimeRange(page); ok {
+			return last, nil
+		}
+	}
+	return time.Time{}, nil
+}
+
+// postTimeRange returns the oldest and newest known post time of posts.
+func postTimeRange(posts []PostDoc) (first, last time.Time, ok bool) {
+	for _, post := range posts {
+		if post.Time.IsZero() {
+			continue
+		}
+		if !ok || post.Time.Before(first) {
+			first = post.Time
+		}
+		if !ok || post.Time.After(last) {
+			last = post.Time
+		}
+		ok = true
+	}
+	return first, last, ok
+}
+
+// DownloadDateRange downloads the posts of ListDateRangeContext through the
+// download manager, see DownloadManager.EnqueuePosts. The reports are in post
+// order, nil for posts which failed before downloading, and the errors of all
+// posts are joined.
+func (p *PTT) DownloadDateRange(ctx context.Context, from, to time.Time, progress ProgressFunc) ([]*DownloadReport, error) {
+	posts, err := p.ListDateRangeContext(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	manager, _ := downloadManagerFrom(ctx)
+	downloads := manager.EnqueuePosts(ctx, p, posts, progress)
+	reports := make([]*DownloadReport, len(downloads))
+	var errs []error
+	for i, d := range downloads {
+		reports[i], err = d.Wait()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", d.Target, err))
+		}
+	}
+	return reports, errors.Join(errs...)
+}
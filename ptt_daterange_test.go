@@ -0,0 +1,62 @@
+package photomgr
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestListDateRange(t *testing.T) {
+	var requests int32
+	server := newPaginatorTestServer(t, 100, &requests)
+	ptt := newHTMLTestPTT(server, PttBackendHTML)
+
+	from, to := paginatorBase.Add(50*time.Hour), paginatorBase.Add(59*time.Hour)
+	posts, err := ptt.ListDateRange(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := postNumbers(posts); got != "50 51 53 54 56 57" {
+		t.Errorf("Expected posts 50 51 53 54 56 57, got %s", got)
+	}
+	// Entry page, about log2(100) probes, then the 4 pages of the range
+	// instead of the whole board.
+	if requests > 15 {
+		t.Errorf("Expected a binary search, got %d page requests", requests)
+	}
+
+	// Ranges outside of the board are empty.
+	for _, r := range [][2]time.Time{
+		{paginatorBase.Add(-48 * time.Hour), paginatorBase.Add(-24 * time.Hour)},
+		{paginatorBase.Add(1000 * time.Hour), paginatorBase.Add(2000 * time.Hour)},
+	} {
+		posts, err := ptt.ListDateRange(r[0], r[1])
+		if err != nil || len(posts) != 0 {
+			t.Errorf("Expected no posts in %v, got %s, err %v", r, postNumbers(posts), err)
+		}
+	}
+	if _, err := ptt.ListDateRange(to, from); err == nil {
+		t.Error("Expected an error for an inverted range")
+	}
+}
+
+func TestDownloadDateRange(t *testing.T) {
+	var requests int32
+	server := newPaginatorTestServer(t, 5, &requests)
+	ptt := newHTMLTestPTT(server, PttBackendHTML)
+	ptt.BaseDir = t.TempDir()
+
+	reports, err := ptt.DownloadDateRange(context.Background(), paginatorBase, paginatorBase.Add(4*time.Hour), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 3 {
+		t.Fatalf("Expected 3 reports, got %d", len(reports))
+	}
+	for i, report := range reports {
+		if report == nil || !strings.HasPrefix(report.Title, "Article /bbs/Beauty/M.") {
+			t.Errorf("Unexpected report %d: %+v", i, report)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package photomgr
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// PttBackend selects how PTT board pages and articles are fetched.
+type PttBackend int
+
+const (
+	// PttBackendAuto uses the markdown Fetcher when PTT.Fetcher or
+	// FIRECRAWL_KEY is set, and falls back to direct HTML parsing when it
+	// fails. Otherwise it always parses HTML directly.
+	PttBackendAuto PttBackend = iota
+	// PttBackendFirecrawl only uses the markdown Fetcher (Firecrawl cloud
+	// unless PTT.Fetcher is set), errors are returned as is.
+	PttBackendFirecrawl
+	// PttBackendHTML fetches ptt.cc with the over18 cookie and parses the
+	// HTML with goquery, no external service is needed.
+	PttBackendHTML
+)
+
+func (b PttBackend) String() string {
+	switch b {
+	case PttBackendAuto:
+		return "auto"
+	case PttBackendFirecrawl:
+		return "firecrawl"
+	case PttBackendHTML:
+		return "html"
+	}
+	return fmt.Sprintf("PttBackend(%d)", int(b))
+}
+
+// fetcher returns the markdown Fetcher of p, Firecrawl cloud by default.
+func (p *PTT) fetcher() Fetcher {
+	if p.Fetcher != nil {
+		return p.Fetcher
+	}
+	return NewFirecrawlFetcher("")
+}
+
+// useFetcher reports whether the backend should try the markdown Fetcher
+// first, and whether it may fall back to HTML on error.
+func (p *PTT) useFetcher() (markdown bool, fallback bool) {
+	switch p.Backend {
+	case PttBackendFirecrawl:
+		return true, false
+	case PttBackendHTML:
+		return false, false
+	}
+	return p.Fetcher != nil || os.Getenv("FIRECRAWL_KEY") != "", true
+}
+
+// fetchIndex fetches a board index or search result page with the configured
+// backend and returns the posts on it.
+func (p *PTT) fetchIndex(ctx context.Context, targetURL string) ([]PostDoc, error) {
+	useFetcher, fallback := p.useFetcher()
+	if useFetcher {
+		markdown, err := p.fetcher().Fetch(ctx, targetURL)
+		if err == nil {
+			return parseMarkdownToPostDocs(markdown, p.baseAddress), nil
+		}
+		err = fmt.Errorf("error fetching markdown for URL %s: %w", targetURL, err)
+		if !fallback || ctx.Err() != nil {
+			return nil, err
+		}
+		log.Printf("fetchIndex: %v, fall back to HTML", err)
+	}
+
+	doc, err := fetchDocument(ctx, targetURL, over18Cookie)
+	if err != nil {
+		return nil, err
+	}
+	return parseIndexHTML(doc, p.baseAddress), nil
+}
+
+// fetchArticle fetches a single article with the configured backend.
+func (p *PTT) fetchArticle(ctx context.Context, url string) (*PttArticle, error) {
+	useFetcher, fallback := p.useFetcher()
+	if useFetcher {
+		markdown, err := p.fetcher().Fetch(ctx, url)
+		if err == nil {
+			return parseArticleMarkdown(markdown, url), nil
+		}
+		err = fmt.Errorf("error fetching markdown for URL %s: %w", url, err)
+		if !fallback || ctx.Err() != nil {
+			return nil, err
+		}
+		log.Printf("fetchArticle: %v, fall back to HTML", err)
+	}
+
+	doc, err := fetchDocument(ctx, url, over18Cookie)
+	if err != nil {
+		return nil, err
+	}
+	return parseArticleHTML(doc, url), nil
+}
+
+// parseIndexHTML extracts posts from the `.r-ent` entries of a PTT index or
+// search result page:
+//
+//	<div class="r-ent">
+//	  <div class="nrec"><span class="hl f3">10</span></div>
+//	  <div class="title"><a href="/bbs/Beauty/M.123.A.XYZ.html">[正妹] Title</a></div>
+//	  <div class="meta"><div class="author">user</div><div class="date"> 5/24</div></div>
+//	</div>
+//
+// Deleted posts (no link) are skipped, and parsing stops at `.r-list-sep`
+// which separates the pinned announcements at the bottom of the newest page.
+func parseIndexHTML(doc *goquery.Document, baseAddress string) []PostDoc {
+	var posts []PostDoc
+	doc.Find(".r-ent, .r-list-sep").EachWithBreak(func(i int, s *goquery.Selection) bool {
+		if s.HasClass("r-list-sep") {
+			return false
+		}
+
+		link := s.Find(".title a")
+		url, ok := link.Attr("href")
+		if !ok {
+			return true
+		}
+		title := strings.TrimSpace(link.Text())
+
+		// Ensure URL is absolute
+		if !strings.HasPrefix(url, "http") {
+			url = baseAddress + url
+		}
+
+		articleID := extractArticleIDFromURL(url)
+		posts = append(posts, PostDoc{
+			ArticleID:    articleID,
+			ArticleTitle: title,
+			Author:       strings.TrimSpace(s.Find(".meta .author").Text()),
+			Date:         strings.TrimSpace(s.Find(".meta .date").Text()),
+			URL:          url,
+			Likeint:      parsePushCount(s.Find(".nrec").Text()),
+			Time:         articleIDTime(articleID),
+		})
+		return true
+	})
+	return posts
+}
+
+// parseArticleHTML extracts the article meta lines, image links, content and
+// pushes from a PTT article page at url.
+func parseArticleHTML(doc *goquery.Document, url string) *PttArticle {
+	article := &PttArticle{}
+	doc.Find(".article-metaline, .article-metaline-right").Each(func(i int, s *goquery.Selection) {
+		value := strings.TrimSpace(s.Find(".article-meta-value").Text())
+		switch strings.TrimSpace(s.Find(".article-meta-tag").Text()) {
+		case "作者":
+			// "user (nickname)" -> "user"
+			if idx := strings.Index(value, " ("); idx > 0 {
+				value = value[:idx]
+			}
+			article.Author = value
+		case "看板":
+			article.Board = value
+		case "標題":
+			article.Title = value
+		case "時間":
+			article.Date = value
+		}
+	})
+
+	setArticleIdentity(article, url)
+
+	article.ImageURLs = extractImageLinks(doc)
+
+	article.Pushes = parsePushesHTML(doc, article.Time)
+
+	// The content is the text of #main-content without meta lines and pushes,
+	// cut at the signature or origin line.
+	main := doc.Find("#main-content").Clone()
+	main.Find(".article-metaline, .article-metaline-right, .push").Remove()
+	content := main.Text()
+	parseArticleFooter(article, content)
+	if loc := pttSignatureRegex.FindStringIndex(content); loc != nil {
+		content = content[:loc[0]]
+	}
+	article.Content = strings.TrimSpace(content)
+	return article
+}
@@ -0,0 +1,309 @@
+package photomgr
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Mock HTML content of a PTT index page and article page.
+const (
+	mockIndexHTML = `<html><body>
+<div class="btn-group btn-group-paging">
+<a class="btn wide" href="/bbs/Beauty/index1.html">最舊</a>
+<a class="btn wide" href="/bbs/Beauty/index3931.html">&lsaquo; 上頁</a>
+<a class="btn wide disabled">下頁 &rsaquo;</a>
+<a class="btn wide" href="/bbs/Beauty/index.html">最新</a>
+</div>
+<div class="r-list-container action-bar-margin bbs-screen">
+<div class="r-ent">
+	<div class="nrec"><span class="hl f3">10</span></div>
+	<div class="title"><a href="/bbs/Beauty/M.1704067200.A.AAA.html">[正妹] HTML Post 1</a></div>
+	<div class="meta"><div class="author">user1</div><div class="article-mark"></div><div class="date"> 1/01</div></div>
+</div>
+<div class="r-ent">
+	<div class="nrec"></div>
+	<div class="title">(本文已被刪除) [user2]</div>
+	<div class="meta"><div class="author">-</div><div class="article-mark"></div><div class="date"> 1/01</div></div>
+</div>
+<div class="r-ent">
+	<div class="nrec"><span class="hl f1">爆</span></div>
+	<div class="title"><a href="/bbs/Beauty/M.1704153600.A.BBB.html">[正妹] HTML Post 2</a></div>
+	<div class="meta"><div class="author">user3</div><div class="article-mark"></div><div class="date"> 1/02</div></div>
+</div>
+<div class="r-ent">
+	<div class="nrec"><span class="f2">X1</span></div>
+	<div class="title"><a href="/bbs/Beauty/M.1704240000.A.CCC.html">[閒聊] HTML Irrelevant</a></div>
+	<div class="meta"><div class="author">user4</div><div class="article-mark"></div><div class="date"> 1/03</div></div>
+</div>
+<div class="r-list-sep"></div>
+<div class="r-ent">
+	<div class="nrec"><span class="hl f3">M</span></div>
+	<div class="title"><a href="/bbs/Beauty/M.1600000000.A.DDD.html">[正妹] Pinned Announcement</a></div>
+	<div class="meta"><div class="author">sysop</div><div class="article-mark">M</div><div class="date"> 9/13</div></div>
+</div>
+</div>
+</body></html>`
+
+	mockArticleHTML = `<html><body>
+<div id="main-content" class="bbs-screen bbs-content"><div class="article-metaline"><span class="article-meta-tag">作者</span><span class="article-meta-value">htmluser (HTML Nick)</span></div><div class="article-metaline-right"><span class="article-meta-tag">看板</span><span class="article-meta-value">Beauty</span></div><div class="article-metaline"><span class="article-meta-tag">標題</span><span class="article-meta-value">[正妹] HTML Article</span></div><div class="article-metaline"><span class="article-meta-tag">時間</span><span class="article-meta-value">Mon Jan  1 08:00:00 2024</span></div>
+This is the HTML content.
+<a href="https://i.imgur.com/htmlimg1.jpg" target="_blank">https://i.imgur.com/htmlimg1.jpg</a>
+<a href="https://imgur.com/htmlimg2" target="_blank">https://imgur.com/htmlimg2</a>
+
+--
+<span class="f2">※ 發信站: 批踢踢實業坊(ptt.cc), 來自: 1.2.3.4 (臺灣)
+</span><span class="f2">※ 文章網址: <a href="https://www.ptt.cc/bbs/Beauty/M.1704067200.A.AAA.html" target="_blank">https://www.ptt.cc/bbs/Beauty/M.1704067200.A.AAA.html</a>
+</span><div class="push"><span class="hl push-tag">推 </span><span class="f3 hl push-userid">pusher1</span><span class="f3 push-content">: nice</span><span class="push-ipdatetime"> 5.6.7.8 01/01 08:10
+</span></div><div class="push"><span class="f1 hl push-tag">噓 </span><span class="f3 hl push-userid">pusher2</span><span class="f3 push-content">: bad</span><span class="push-ipdatetime"> 01/01 08:20
+</span></div><div class="push"><span class="hl push-tag">推 </span><span class="f3 hl push-userid">pusher3</span><span class="f3 push-content">: great</span><span class="push-ipdatetime"> 01/02 09:00
+</span></div></div>
+</body></html>`
+)
+
+// newHTMLTestServer serves mockIndexHTML for index and search pages and
+// mockArticleHTML for articles. It checks the over18 cookie is set.
+func newHTMLTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie("over18"); err != nil || c.Value != "1" {
+			t.Errorf("Expected over18=1 cookie for %s", r.URL)
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		switch {
+		case strings.Contains(r.URL.Path, "/M."):
+			w.Write([]byte(mockArticleHTML))
+		case strings.Contains(r.URL.Path, "/index") || strings.Contains(r.URL.Path, "/search"):
+			w.Write([]byte(mockIndexHTML))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newHTMLTestPTT returns a PTT pointing to server.
+func newHTMLTestPTT(server *httptest.Server, backend PttBackend) *PTT {
+	ptt := NewPTT()
+	ptt.Backend = backend
+	ptt.baseAddress = server.URL
+	ptt.entryAddress = server.URL + "/bbs/Beauty/index.html"
+	ptt.SearchAddress = server.URL + "/bbs/Beauty/search?q="
+	return ptt
+}
+
+func TestParsePttPageByIndex_HTMLBackend(t *testing.T) {
+	server := newHTMLTestServer(t)
+	ptt := newHTMLTestPTT(server, PttBackendHTML)
+
+	count := ptt.ParsePttPageByIndex(0, true)
+	if count != 2 {
+		t.Fatalf("Expected 2 posts, got %d", count)
+	}
+
+	expected := []PostDoc{
+		{ArticleID: "M.1704067200.A.AAA", ArticleTitle: "[正妹] HTML Post 1", URL: server.URL + "/bbs/Beauty/M.1704067200.A.AAA.html", Likeint: 10},
+		{ArticleID: "M.1704153600.A.BBB", ArticleTitle: "[正妹] HTML Post 2", URL: server.URL + "/bbs/Beauty/M.1704153600.A.BBB.html", Likeint: 100},
+	}
+	for i, post := range ptt.storedPost {
+		if post.ArticleID != expected[i].ArticleID || post.ArticleTitle != expected[i].ArticleTitle ||
+			post.URL != expected[i].URL || post.Likeint != expected[i].Likeint {
+			t.Errorf("Post %d: expected %+v, got %+v", i, expected[i], post)
+		}
+	}
+}
+
+func TestParseSearchByKeyword_HTMLBackend(t *testing.T) {
+	server := newHTMLTestServer(t)
+	ptt := newHTMLTestPTT(server, PttBackendHTML)
+
+	if count := ptt.ParseSearchByKeyword("keyword"); count != 2 {
+		t.Errorf("Expected 2 posts from search, got %d", count)
+	}
+}
+
+func TestSearch_EscapedKeyword(t *testing.T) {
+	var query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query().Get("q")
+		w.Write([]byte(mockIndexHTML))
+	}))
+	defer server.Close()
+	ptt := newHTMLTestPTT(server, PttBackendHTML)
+
+	keyword := "[正妹] a&b #1"
+	posts, err := ptt.Search(keyword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query != keyword || len(posts) != 2 {
+		t.Errorf("Expected 2 posts for query %q, got %d for %q", keyword, len(posts), query)
+	}
+}
+
+func TestGetAllFromURL_HTMLBackend(t *testing.T) {
+	server := newHTMLTestServer(t)
+	ptt := newHTMLTestPTT(server, PttBackendHTML)
+
+	title, images, like, dis := ptt.GetAllFromURL(server.URL + "/bbs/Beauty/M.1704067200.A.AAA.html")
+	if title != "[正妹] HTML Article" {
+		t.Errorf("Expected title '[正妹] HTML Article', got '%s'", title)
+	}
+	expectedImages := []string{"https://i.imgur.com/htmlimg1.jpg", "https://i.imgur.com/htmlimg2.jpeg"}
+	if len(images) != len(expectedImages) {
+		t.Fatalf("Expected %d images, got %v", len(expectedImages), images)
+	}
+	for i := range expectedImages {
+		if images[i] != expectedImages[i] {
+			t.Errorf("Expected image %d to be '%s', got '%s'", i, expectedImages[i], images[i])
+		}
+	}
+	if like != 2 || dis != 1 {
+		t.Errorf("Expected like=2, dis=1, got like=%d, dis=%d", like, dis)
+	}
+}
+
+func TestParseArticleHTML_MetaAndContent(t *testing.T) {
+	server := newHTMLTestServer(t)
+	doc, err := fetchDocument(context.Background(), server.URL+"/bbs/Beauty/M.1704067200.A.AAA.html", over18Cookie)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	article := parseArticleHTML(doc, "dummy")
+	if article.Author != "htmluser" || article.Board != "Beauty" || article.Date != "Mon Jan  1 08:00:00 2024" {
+		t.Errorf("Unexpected meta: author=%q board=%q date=%q", article.Author, article.Board, article.Date)
+	}
+	if !strings.HasPrefix(article.Content, "This is the HTML content.") || strings.Contains(article.Content, "發信站") {
+		t.Errorf("Unexpected content: %q", article.Content)
+	}
+}
+
+func TestAutoBackend_FallbackToHTML(t *testing.T) {
+	t.Setenv("FIRECRAWL_KEY", "test_key")
+	firecrawl := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusPaymentRequired)
+	}))
+	defer firecrawl.Close()
+	originalURL := firecrawlScrapeURL
+	firecrawlScrapeURL = firecrawl.URL
+	t.Cleanup(func() { firecrawlScrapeURL = originalURL })
+
+	server := newHTMLTestServer(t)
+	ptt := newHTMLTestPTT(server, PttBackendAuto)
+	if count := ptt.ParsePttPageByIndex(0, true); count != 2 {
+		t.Errorf("Expected 2 posts after falling back to HTML, got %d", count)
+	}
+
+	ptt.Backend = PttBackendFirecrawl
+	if count := ptt.ParsePttPageByIndex(0, true); count != 0 {
+		t.Errorf("Expected 0 posts without fallback, got %d", count)
+	}
+}
+
+func TestPageByOffset_HTMLBackend(t *testing.T) {
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.Path)
+		w.Write([]byte(mockIndexHTML))
+	}))
+	defer server.Close()
+	ptt := newHTMLTestPTT(server, PttBackendHTML)
+
+	if newest := ptt.NewestIndex(); newest != 3932 {
+		t.Fatalf("Expected newest index 3932 from 上頁 link, got %d", newest)
+	}
+	if count := ptt.PageByOffset(1); count != 2 {
+		t.Errorf("Expected 2 posts on offset 1, got %d", count)
+	}
+	if count := ptt.PageByAbsoluteIndex(5); count != 2 {
+		t.Errorf("Expected 2 posts on index5, got %d", count)
+	}
+	// The newest index is cached, so the entry page is only fetched once.
+	expected := []string{"/bbs/Beauty/index.html", "/bbs/Beauty/index3931.html", "/bbs/Beauty/index5.html"}
+	if strings.Join(requested, " ") != strings.Join(expected, " ") {
+		t.Errorf("Expected requests %v, got %v", expected, requested)
+	}
+
+	_, err := ptt.PageByOffsetContext(context.Background(), 3932)
+	if !errors.Is(err, ErrNotFound) || ptt.GetCurrentPageResultCount() != 0 {
+		t.Errorf("Expected ErrNotFound and empty result before index1, got %v", err)
+	}
+}
+
+func TestNewestIndexFromMarkdown(t *testing.T) {
+	tests := []struct {
+		markdown string
+		expected int
+	}{
+		{"[最舊](https://www.ptt.cc/bbs/Beauty/index1.html)\n[‹ 上頁](https://www.ptt.cc/bbs/Beauty/index100.html)", 101},
+		// Links output only, the largest index of the board is the previous page.
+		{"[](https://www.ptt.cc/bbs/Beauty/index1.html)\n[](https://www.ptt.cc/bbs/Beauty/index3931.html)\n[](https://www.ptt.cc/bbs/Gossiping/index9999.html)", 3932},
+		{"## No paging links", 0},
+	}
+	for _, tt := range tests {
+		if got, _ := newestIndexFromMarkdown(tt.markdown, "Beauty"); got != tt.expected {
+			t.Errorf("newestIndexFromMarkdown(%q) = %d, expected %d", tt.markdown, got, tt.expected)
+		}
+	}
+}
+
+func TestListing_AuthorAndDate(t *testing.T) {
+	server := newHTMLTestServer(t)
+	for _, backend := range []PttBackend{PttBackendHTML, PttBackendFirecrawl} {
+		ptt := newHTMLTestPTT(server, backend)
+		ptt.Fetcher = &HTMLFetcher{}
+		ptt.TitleFilter = nil
+
+		if count := ptt.ParseSearchByKeyword("keyword"); count != 3 {
+			t.Fatalf("%v: expected 3 posts, got %d", backend, count)
+		}
+		entries := ptt.GetPostEntries()
+		last := entries[2]
+		if last.ArticleID != "M.1704240000.A.CCC" || last.Author != "user4" || last.Date != "1/03" || last.PushCount != 0 {
+			t.Errorf("%v: unexpected entry %+v", backend, last)
+		}
+		if !last.Time.Equal(time.Unix(1704240000, 0)) || ptt.GetPostUnixTimeByIndex(2) != 1704240000 {
+			t.Errorf("%v: expected time from article ID, got %v", backend, last.Time)
+		}
+		if ptt.GetPostAuthorByIndex(0) != "user1" || ptt.GetPostDateByIndex(1) != "1/02" {
+			t.Errorf("%v: unexpected author or date getters: %q %q", backend, ptt.GetPostAuthorByIndex(0), ptt.GetPostDateByIndex(1))
+		}
+	}
+}
+
+func TestListPage_Concurrent(t *testing.T) {
+	server := newHTMLTestServer(t)
+	ptt := newHTMLTestPTT(server, PttBackendHTML)
+	ptt.storedPost = []PostDoc{{ArticleTitle: "stored"}}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var posts []PostDoc
+			var err error
+			if i%2 == 0 {
+				posts, err = ptt.ListPageContext(context.Background(), i)
+			} else {
+				posts, err = ptt.SearchContext(context.Background(), "keyword")
+			}
+			if err != nil || len(posts) != 2 || posts[1].ArticleTitle != "[正妹] HTML Post 2" {
+				t.Errorf("Goroutine %d: unexpected posts %+v, err %v", i, posts, err)
+			}
+			ptt.GetPostTitleByIndex(0)
+		}(i)
+	}
+	wg.Wait()
+
+	if len(ptt.storedPost) != 1 || ptt.GetPostTitleByIndex(0) != "stored" {
+		t.Errorf("Expected List methods to leave the stored result, got %+v", ptt.storedPost)
+	}
+}
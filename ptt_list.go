@@ -0,0 +1,92 @@
+package photomgr
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+)
+
+// The List and Search methods return the posts instead of storing them, so
+// unlike the Parse methods and the index getters they can be used from many
+// goroutines on the same PTT. The posts are filtered by TitleFilter.
+
+// ListPage returns the posts of the board page n pages older than the newest
+// one, 0 is the newest page, see PageByOffset.
+func (p *PTT) ListPage(n int) ([]PostDoc, error) {
+	return p.ListPageContext(context.Background(), n)
+}
+
+// ListPageContext is the context-aware version of ListPage. An offset older
+// than index1.html returns ErrNotFound.
+func (p *PTT) ListPageContext(ctx context.Context, n int) ([]PostDoc, error) {
+	if n <= 0 {
+		return p.ListAbsolutePageContext(ctx, 0)
+	}
+
+	newest, err := p.NewestIndexContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	index := newest - n
+	if index < 1 {
+		return nil, fmt.Errorf("%w: offset %d is older than index1.html (newest index %d)", ErrNotFound, n, newest)
+	}
+	return p.ListAbsolutePageContext(ctx, index)
+}
+
+// ListAbsolutePage returns the posts of board page index<n>.html, index1.html
+// is the oldest page and 0 is the newest page index.html.
+func (p *PTT) ListAbsolutePage(n int) ([]PostDoc, error) {
+	return p.ListAbsolutePageContext(context.Background(), n)
+}
+
+// ListAbsolutePageContext is the context-aware version of ListAbsolutePage.
+func (p *PTT) ListAbsolutePageContext(ctx context.Context, n int) ([]PostDoc, error) {
+	targetURL := p.indexURL(n)
+	log.Printf("ParsePttPageByIndex: Target URL for page %d: %s", n, targetURL)
+
+	posts, err := p.fetchIndex(ctx, targetURL)
+	if err != nil {
+		return nil, err
+	}
+	return p.filterPosts(posts), nil
+}
+
+// Search returns the posts of the board matching keyword.
+func (p *PTT) Search(keyword string) ([]PostDoc, error) {
+	return p.SearchContext(context.Background(), keyword)
+}
+
+// SearchContext is the context-aware version of Search.
+func (p *PTT) SearchContext(ctx context.Context, keyword string) ([]PostDoc, error) {
+	targetURL := p.SearchAddress + url.QueryEscape(keyword)
+	log.Printf("ParseSearchByKeyword: Target URL for keyword '%s': %s", keyword, targetURL)
+
+	posts, err := p.fetchIndex(ctx, targetURL)
+	if err != nil {
+		return nil, err
+	}
+	return p.filterPosts(posts), nil
+}
+
+// ListByNumber returns at least num posts, newest first, from board page
+// index<page>.html (0 is the newest page) and the older pages before it. It
+// reads whole pages and at most DefaultMaxPages of them, see Paginate.
+func (p *PTT) ListByNumber(num int, page int) ([]PostDoc, error) {
+	return p.ListByNumberContext(context.Background(), num, page)
+}
+
+// ListByNumberContext is the context-aware version of ListByNumber. It stops
+// at the first failed page and returns the posts so far with the error.
+func (p *PTT) ListByNumberContext(ctx context.Context, num int, page int) ([]PostDoc, error) {
+	it := p.Paginate(ctx, PaginateOptions{StartIndex: page})
+	var posts []PostDoc
+	for it.Next() {
+		posts = append(posts, it.Posts()...)
+		if len(posts) >= num {
+			break
+		}
+	}
+	return posts, it.Err()
+}
@@ -0,0 +1,178 @@
+package photomgr
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// newestIndexTTL is how long a discovered newest index number is reused
+// before the board entry page is fetched again.
+const newestIndexTTL = 5 * time.Minute
+
+var (
+	// prevPageLinkRegex matches the "‹ 上頁" button link in markdown:
+	// "[‹ 上頁](https://www.ptt.cc/bbs/Beauty/index3931.html)" -> "3931"
+	prevPageLinkRegex = regexp.MustCompile(`\[[^\]]*上頁[^\]]*\]\([^)\s]*/index(\d+)\.html\)`)
+	// indexLinkRegex matches any board index page link, group 1 is the board
+	// and group 2 the index number.
+	indexLinkRegex = regexp.MustCompile(`/bbs/([^/\s]+)/index(\d+)\.html`)
+)
+
+// newestIndexCache keeps the newest index number of a board.
+type newestIndexCache struct {
+	mu      sync.Mutex
+	board   string
+	index   int
+	fetched time.Time
+}
+
+// indexURL returns the address of board page index<page>.html, or the
+// newest page index.html when page is 0.
+func (p *PTT) indexURL(page int) string {
+	if page > 0 {
+		return fmt.Sprintf("%s/bbs/%s/index%d.html", p.baseAddress, p.Board, page)
+	}
+	return p.entryAddress // This is usually https://www.ptt.cc/bbs/Beauty/index.html
+}
+
+// NewestIndex returns the number N of the newest board page, which is also
+// reachable as index<N>.html. It returns 0 on error.
+func (p *PTT) NewestIndex() int {
+	index, err := p.NewestIndexContext(context.Background())
+	if err != nil {
+		log.Println("NewestIndex:", err)
+	}
+	return index
+}
+
+// NewestIndexContext returns the number N of the newest board page, it is
+// discovered from the "上頁" link of the entry page and cached for a while.
+func (p *PTT) NewestIndexContext(ctx context.Context) (int, error) {
+	c := &p.newest
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.index > 0 && c.board == p.Board && time.Since(c.fetched) < newestIndexTTL {
+		return c.index, nil
+	}
+
+	index, err := p.fetchNewestIndex(ctx)
+	if err != nil {
+		return 0, err
+	}
+	c.board, c.index, c.fetched = p.Board, index, time.Now()
+	return index, nil
+}
+
+// fetchNewestIndex fetches the entry page with the configured backend and
+// discovers the newest index number from it.
+func (p *PTT) fetchNewestIndex(ctx context.Context) (int, error) {
+	useFetcher, fallback := p.useFetcher()
+	if useFetcher {
+		markdown, err := p.fetcher().Fetch(ctx, p.entryAddress)
+		if err == nil {
+			if index, ok := newestIndexFromMarkdown(markdown, p.Board); ok {
+				return index, nil
+			}
+			err = fmt.Errorf("%w: no 上頁 link in markdown of %s", ErrParseFailed, p.entryAddress)
+		} else {
+			err = fmt.Errorf("error fetching markdown for URL %s: %w", p.entryAddress, err)
+		}
+		if !fallback || ctx.Err() != nil {
+			return 0, err
+		}
+		log.Printf("fetchNewestIndex: %v, fall back to HTML", err)
+	}
+
+	doc, err := fetchDocument(ctx, p.entryAddress, over18Cookie)
+	if err != nil {
+		return 0, err
+	}
+	if index, ok := newestIndexFromHTML(doc); ok {
+		return index, nil
+	}
+	return 0, fmt.Errorf("%w: no 上頁 link in %s", ErrParseFailed, p.entryAddress)
+}
+
+// newestIndexFromMarkdown returns the newest index number, which is one more
+// than the "上頁" link of the newest page. When the button was stripped, the
+// largest index link of board (e.g. from Firecrawl links output) is used.
+func newestIndexFromMarkdown(markdown string, board string) (int, bool) {
+	if match := prevPageLinkRegex.FindStringSubmatch(markdown); match != nil {
+		prev, err := strconv.Atoi(match[1])
+		return prev + 1, err == nil
+	}
+
+	prev := 0
+	for _, match := range indexLinkRegex.FindAllStringSubmatch(markdown, -1) {
+		if !strings.EqualFold(match[1], board) {
+			continue
+		}
+		if n, err := strconv.Atoi(match[2]); err == nil && n > prev {
+			prev = n
+		}
+	}
+	if prev == 0 {
+		return 0, false
+	}
+	return prev + 1, true
+}
+
+// newestIndexFromHTML returns one more than the "‹ 上頁" button link of the
+// newest page.
+func newestIndexFromHTML(doc *goquery.Document) (int, bool) {
+	index := 0
+	doc.Find(".btn-group-paging a").Each(func(i int, s *goquery.Selection) {
+		if !strings.Contains(s.Text(), "上頁") {
+			return
+		}
+		href, _ := s.Attr("href")
+		if match := indexLinkRegex.FindStringSubmatch(href); match != nil {
+			if prev, err := strconv.Atoi(match[2]); err == nil {
+				index = prev + 1
+			}
+		}
+	})
+	return index, index > 0
+}
+
+// PageByOffset fetches the board page n pages older than the newest one and
+// replaces current result, 0 is the newest page. Return article count.
+func (p *PTT) PageByOffset(n int) int {
+	count, err := p.PageByOffsetContext(context.Background(), n)
+	if err != nil {
+		log.Printf("PageByOffset: offset %d: %v", n, err)
+	}
+	return count
+}
+
+// PageByOffsetContext is the context-aware version of PageByOffset. An
+// offset older than index1.html returns ErrNotFound. The stored result is
+// cleared on error.
+func (p *PTT) PageByOffsetContext(ctx context.Context, n int) (int, error) {
+	posts, err := p.ListPageContext(ctx, n)
+	count := p.setPosts(posts)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// PageByAbsoluteIndex fetches board page index<n>.html and replaces current
+// result, index1.html is the oldest page. Return article count.
+func (p *PTT) PageByAbsoluteIndex(n int) int {
+	return p.ParsePttPageByIndex(n, true)
+}
+
+// PageByAbsoluteIndexContext is the context-aware version of PageByAbsoluteIndex.
+func (p *PTT) PageByAbsoluteIndexContext(ctx context.Context, n int) (int, error) {
+	return p.ParsePttPageByIndexContext(ctx, n, true)
+}
@@ -0,0 +1,154 @@
+package photomgr
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultMaxPages bounds a Paginator without PaginateOptions.MaxPages.
+const DefaultMaxPages = 100
+
+// PaginateOptions are the start page and stop conditions of a Paginator. The
+// zero value walks back at most DefaultMaxPages pages from the newest page.
+type PaginateOptions struct {
+	// StartIndex is the absolute number of the first page, index<N>.html,
+	// 0 means the newest page.
+	StartIndex int
+	// MaxPosts stops after this many posts, 0 means no limit.
+	MaxPosts int
+	// MaxPages stops after this many pages, 0 means DefaultMaxPages and a
+	// negative value means no limit other than index1.html.
+	MaxPages int
+	// Oldest stops at the first post older than it, zero means no limit.
+	// Posts without a known time never stop the walk.
+	Oldest time.Time
+	// Stop stops at the first post it returns true for, nil means never.
+	Stop func(PostDoc) bool
+}
+
+// Paginator walks backward through a PTT board from a start page, yielding
+// the posts page by page, newest first, until a stop condition is met, the
+// oldest page index1.html was read, a page fails or ctx is done. The posts
+// are filtered by the TitleFilter of the PTT. Use it like bufio.Scanner:
+//
+//	it := ptt.Paginate(ctx, PaginateOptions{MaxPosts: 200})
+//	for it.Next() {
+//		for _, post := range it.Posts() { ... }
+//	}
+//	if err := it.Err(); err != nil { ... }
+type Paginator struct {
+	ptt  *PTT
+	ctx  context.Context
+	opts PaginateOptions
+
+	index int // Next page to fetch, 0 before the newest index is known
+	pages int
+	count int
+	done  bool
+	posts []PostDoc
+	page  int
+	err   error
+}
+
+// Paginate returns a Paginator over the board of p, see PaginateOptions.
+func (p *PTT) Paginate(ctx context.Context, opts PaginateOptions) *Paginator {
+	if opts.MaxPages == 0 {
+		opts.MaxPages = DefaultMaxPages
+	}
+	return &Paginator{ptt: p, ctx: ctx, opts: opts, index: opts.StartIndex}
+}
+
+// Next fetches the next page, it returns false when the walk is over. Pages
+// whose posts were all dropped by TitleFilter are skipped but still count
+// against MaxPages.
+func (it *Paginator) Next() bool {
+	for !it.done {
+		if it.opts.MaxPages > 0 && it.pages >= it.opts.MaxPages {
+			it.done = true
+			break
+		}
+		if err := it.ctx.Err(); err != nil {
+			it.err, it.done = err, true
+			break
+		}
+		if it.index <= 0 {
+			newest, err := it.ptt.NewestIndexContext(it.ctx)
+			if err != nil {
+				it.err, it.done = err, true
+				break
+			}
+			it.index = newest
+		}
+
+		posts, err := it.ptt.ListAbsolutePageContext(it.ctx, it.index)
+		if err != nil {
+			it.err, it.done = err, true
+			break
+		}
+		it.page = it.index
+		it.pages++
+		it.index--
+		if it.index < 1 {
+			it.done = true // index1.html was the oldest page
+		}
+
+		it.posts = it.take(posts)
+		if len(it.posts) > 0 {
+			return true
+		}
+	}
+	it.posts = nil
+	return false
+}
+
+// take returns the posts of a page, newest first, up to the first one
+// meeting a stop condition, which ends the walk.
+func (it *Paginator) take(page []PostDoc) []PostDoc {
+	var posts []PostDoc
+	for i := len(page) - 1; i >= 0; i-- {
+		post := page[i]
+		if it.opts.MaxPosts > 0 && it.count >= it.opts.MaxPosts ||
+			!it.opts.Oldest.IsZero() && !post.Time.IsZero() && post.Time.Before(it.opts.Oldest) ||
+			it.opts.Stop != nil && it.opts.Stop(post) {
+			it.done = true
+			break
+		}
+		posts = append(posts, post)
+		it.count++
+	}
+	if it.opts.MaxPosts > 0 && it.count >= it.opts.MaxPosts {
+		it.done = true
+	}
+	return posts
+}
+
+// Posts returns the posts of the current page, newest first.
+func (it *Paginator) Posts() []PostDoc {
+	return it.posts
+}
+
+// Page returns the absolute number N of the current page, index<N>.html.
+func (it *Paginator) Page() int {
+	return it.page
+}
+
+// Count returns the number of posts yielded so far.
+func (it *Paginator) Count() int {
+	return it.count
+}
+
+// Err returns the error which ended the walk, nil when it ended on a stop
+// condition or at index1.html.
+func (it *Paginator) Err() error {
+	return it.err
+}
+
+// All walks the remaining pages and returns all posts, newest first, with
+// the error which ended the walk if any.
+func (it *Paginator) All() ([]PostDoc, error) {
+	var posts []PostDoc
+	for it.Next() {
+		posts = append(posts, it.Posts()...)
+	}
+	return posts, it.Err()
+}
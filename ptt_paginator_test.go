@@ -0,0 +1,179 @@
+package photomgr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// paginatorBase is the time of the first post of the mock board.
+var paginatorBase = time.Date(2024, 1, 1, 0, 0, 0, 0, taiwanLocation)
+
+// newPaginatorTestServer serves a board of pages index1.html to
+// index<newest>.html with 3 posts each, one hour apart, and counts the page
+// requests. The middle post of every page is not a [正妹] post. Articles
+// have a title and no image.
+func newPaginatorTestServer(t *testing.T, newest int, requests *int32) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/M.") {
+			fmt.Fprintf(w, `<html><body><div class="article-metaline"><span class="article-meta-tag">標題</span><span class="article-meta-value">Article %s</span></div></body></html>`, r.URL.Path)
+			return
+		}
+		atomic.AddInt32(requests, 1)
+		page := newest
+		if r.URL.Path != "/bbs/Beauty/index.html" {
+			if _, err := fmt.Sscanf(r.URL.Path, "/bbs/Beauty/index%d.html", &page); err != nil || page < 1 || page > newest {
+				http.NotFound(w, r)
+				return
+			}
+		}
+
+		var b strings.Builder
+		fmt.Fprintf(&b, `<html><body><div class="btn-group btn-group-paging"><a class="btn wide" href="/bbs/Beauty/index%d.html">&lsaquo; 上頁</a></div>`, page-1)
+		for i := 0; i < 3; i++ {
+			n := (page-1)*3 + i
+			title := fmt.Sprintf("[正妹] Post %d", n)
+			if i == 1 {
+				title = fmt.Sprintf("[閒聊] Post %d", n)
+			}
+			unix := paginatorBase.Add(time.Duration(n) * time.Hour).Unix()
+			fmt.Fprintf(&b, `<div class="r-ent"><div class="nrec">%d</div><div class="title"><a href="/bbs/Beauty/M.%d.A.%03d.html">%s</a></div><div class="meta"><div class="author">user</div><div class="date"> 1/01</div></div></div>`, n, unix, n, title)
+		}
+		b.WriteString(`</body></html>`)
+		w.Write([]byte(b.String()))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func postNumbers(posts []PostDoc) string {
+	var numbers []string
+	for _, post := range posts {
+		numbers = append(numbers, strings.TrimPrefix(post.ArticleTitle, "[正妹] Post "))
+	}
+	return strings.Join(numbers, " ")
+}
+
+func TestPaginator_StopConditions(t *testing.T) {
+	var requests int32
+	server := newPaginatorTestServer(t, 10, &requests)
+	ptt := newHTMLTestPTT(server, PttBackendHTML)
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		opts     PaginateOptions
+		expected string
+	}{
+		{"max posts", PaginateOptions{MaxPosts: 3}, "29 27 26"},
+		{"max pages", PaginateOptions{MaxPages: 2}, "29 27 26 24"},
+		{"start index", PaginateOptions{StartIndex: 2, MaxPages: 5}, "5 3 2 0"},
+		{"oldest", PaginateOptions{Oldest: paginatorBase.Add(24 * time.Hour)}, "29 27 26 24"},
+		{"predicate", PaginateOptions{Stop: func(post PostDoc) bool { return post.Likeint < 27 }}, "29 27"},
+	}
+	for _, tt := range tests {
+		it := ptt.Paginate(ctx, tt.opts)
+		posts, err := it.All()
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if got := postNumbers(posts); got != tt.expected {
+			t.Errorf("%s: expected posts %s, got %s", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestPaginator_Pages(t *testing.T) {
+	var requests int32
+	server := newPaginatorTestServer(t, 3, &requests)
+	ptt := newHTMLTestPTT(server, PttBackendHTML)
+
+	// The walk ends at index1.html without error.
+	it := ptt.Paginate(context.Background(), PaginateOptions{MaxPages: -1})
+	var pages []int
+	for it.Next() {
+		pages = append(pages, it.Page())
+		if len(it.Posts()) != 2 {
+			t.Errorf("Expected 2 posts on page %d, got %d", it.Page(), len(it.Posts()))
+		}
+	}
+	if it.Err() != nil || fmt.Sprint(pages) != "[3 2 1]" || it.Count() != 6 {
+		t.Errorf("Expected pages [3 2 1] and 6 posts, got %v, %d posts, err %v", pages, it.Count(), it.Err())
+	}
+}
+
+func TestPaginator_Bounded(t *testing.T) {
+	var requests int32
+	server := newPaginatorTestServer(t, 1000, &requests)
+	ptt := newHTMLTestPTT(server, PttBackendHTML)
+	ptt.TitleFilter = TitleCategoryFilter("none")
+
+	// The filter drops every post, ParsePttByNumber still stops.
+	if count := ptt.ParsePttByNumber(10, 0); count != 0 {
+		t.Errorf("Expected 0 posts, got %d", count)
+	}
+	// The entry page for the newest index, then DefaultMaxPages pages.
+	if requests != DefaultMaxPages+1 {
+		t.Errorf("Expected %d requests, got %d", DefaultMaxPages+1, requests)
+	}
+
+	// A failed page ends the walk with its error.
+	ptt.TitleFilter = nil
+	it := ptt.Paginate(context.Background(), PaginateOptions{StartIndex: 1001})
+	if it.Next() || !errors.Is(it.Err(), ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a missing page, got %v", it.Err())
+	}
+
+	// Cancel stops the walk.
+	ctx, cancel := context.WithCancel(context.Background())
+	it = ptt.Paginate(ctx, PaginateOptions{MaxPages: -1})
+	if !it.Next() {
+		t.Fatalf("Expected a first page, got %v", it.Err())
+	}
+	cancel()
+	if it.Next() || !errors.Is(it.Err(), context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", it.Err())
+	}
+}
+
+func TestListByNumber_Backward(t *testing.T) {
+	var requests int32
+	server := newPaginatorTestServer(t, 10, &requests)
+	ptt := newHTMLTestPTT(server, PttBackendHTML)
+
+	// Whole pages are read until at least 3 posts.
+	posts, err := ptt.ListByNumber(3, 0)
+	if err != nil || postNumbers(posts) != "29 27 26 24" {
+		t.Errorf("Expected posts 29 27 26 24, got %s, err %v", postNumbers(posts), err)
+	}
+}
+
+func TestPaginator_MarkdownPinnedPosts(t *testing.T) {
+	// The newest page as markdown, with two pinned announcements from years
+	// ago after the newest post.
+	var b strings.Builder
+	for i, unix := range []int64{1704067200, 1704070800, 1704074400, 1500000000, 1600000000} {
+		fmt.Fprintf(&b, "## [正妹] Post %d\n[Read More](https://www.ptt.cc/bbs/Beauty/M.%d.A.%03d.html)\nAuthor: user Date: 1/01 Push: 1\n\n", i, unix, i)
+	}
+	ptt := NewPTT()
+	ptt.Backend = PttBackendFirecrawl
+	ptt.Fetcher = fetcherFunc(func(ctx context.Context, targetURL string) (string, error) {
+		return b.String(), nil
+	})
+
+	it := ptt.Paginate(context.Background(), PaginateOptions{StartIndex: 5, MaxPages: 1, Oldest: time.Unix(1704067200, 0)})
+	posts, err := it.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := postNumbers(posts); got != "2 1 0" {
+		t.Errorf("Expected posts 2 1 0 without the pinned ones, got %s", got)
+	}
+}
@@ -0,0 +1,174 @@
+package photomgr
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Push tags of a PTT article comment.
+const (
+	PushLike    = "推"
+	PushDislike = "噓"
+	PushNeutral = "→"
+)
+
+// PttPush is a single push (comment) of a PTT article.
+type PttPush struct {
+	Tag    string `json:"tag"` // PushLike, PushDislike or PushNeutral
+	UserID string `json:"user_id"`
+	Text   string `json:"text"`
+	IP     string `json:"ip,omitempty"` // Only shown on boards which log push IPs
+	// DateTime is the raw "01/02 15:04" stamp, Time is the same stamp with
+	// the year taken from the article. Time is zero if it can not be parsed.
+	DateTime string    `json:"datetime"`
+	Time     time.Time `json:"time"`
+}
+
+// PttPushSummary holds the totals derived from the pushes of an article.
+type PttPushSummary struct {
+	Total   int `json:"total"`
+	Like    int `json:"like"`    // 推
+	Dislike int `json:"dislike"` // 噓
+	Neutral int `json:"neutral"` // →
+	// Score is Like - Dislike, as shown in the board listing.
+	Score int `json:"score"`
+	// Users is the number of distinct users who pushed.
+	Users int `json:"users"`
+}
+
+// SummarizePushes counts the pushes by tag and user.
+func SummarizePushes(pushes []PttPush) PttPushSummary {
+	var s PttPushSummary
+	users := make(map[string]bool)
+	for _, push := range pushes {
+		switch push.Tag {
+		case PushLike:
+			s.Like++
+		case PushDislike:
+			s.Dislike++
+		default:
+			s.Neutral++
+		}
+		users[push.UserID] = true
+	}
+	s.Total = len(pushes)
+	s.Score = s.Like - s.Dislike
+	s.Users = len(users)
+	return s
+}
+
+// taiwanLocation is the time zone of the dates shown by PTT and CK101.
+var taiwanLocation = time.FixedZone("CST", 8*60*60)
+
+var (
+	// pushIPDateTimeRegex splits " 1.2.3.4 01/02 15:04" into IP and date time,
+	// the IP is optional.
+	pushIPDateTimeRegex = regexp.MustCompile(`^\s*(?:(\d{1,3}(?:\.\d{1,3}){3})\s*)?(\d{1,2}/\d{1,2}(?:\s+\d{1,2}:\d{2})?)?\s*$`)
+	// pushMarkdownRegex matches a push line in markdown:
+	// "推 user1: nice 1.2.3.4 01/02 15:04"
+	pushMarkdownRegex = regexp.MustCompile(`(?m)^[ \t]*(推|噓|→)[ \t]*([A-Za-z0-9_]+)[ \t]*:[ \t]?(.*?)[ \t]*((?:\d{1,3}(?:\.\d{1,3}){3}[ \t]+)?\d{1,2}/\d{1,2}(?:[ \t]+\d{1,2}:\d{2})?)?[ \t]*$`)
+)
+
+// parsePttDate parses the article date such as "Mon Jan  1 08:00:00 2024".
+func parsePttDate(date string) (time.Time, bool) {
+	t, err := time.ParseInLocation("Mon Jan _2 15:04:05 2006", strings.Join(strings.Fields(date), " "), taiwanLocation)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// articleTime returns the post time of an article from its date, or the
+// M.<unix>.A.XXX timestamp of url. It is zero if neither can be parsed.
+func articleTime(date string, url string) time.Time {
+	if t, ok := parsePttDate(date); ok {
+		return t
+	}
+	return articleIDTime(url)
+}
+
+// newPttPush builds a push from its parts, the year of the push time is
+// taken from posted, and pushes in an earlier month belong to the next year.
+func newPttPush(tag, userID, text, ipDateTime string, posted time.Time) PttPush {
+	push := PttPush{
+		Tag:    strings.TrimSpace(tag),
+		UserID: strings.TrimSpace(userID),
+		Text:   strings.TrimSpace(strings.TrimPrefix(text, ":")),
+	}
+	if match := pushIPDateTimeRegex.FindStringSubmatch(ipDateTime); match != nil {
+		push.IP = match[1]
+		push.DateTime = strings.Join(strings.Fields(match[2]), " ")
+	}
+	if push.DateTime == "" || posted.IsZero() {
+		return push
+	}
+
+	layout := "01/02 15:04"
+	if !strings.Contains(push.DateTime, ":") {
+		layout = "01/02"
+	}
+	t, err := time.ParseInLocation(layout, push.DateTime, taiwanLocation)
+	if err != nil {
+		return push
+	}
+	year := posted.Year()
+	if t.Month() < posted.Month() {
+		year++
+	}
+	push.Time = time.Date(year, t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, taiwanLocation)
+	return push
+}
+
+// parsePushesHTML extracts the ordered `.push` entries of an article page:
+//
+//	<div class="push"><span class="push-tag">推 </span><span class="push-userid">user</span>
+//	<span class="push-content">: text</span><span class="push-ipdatetime"> 1.2.3.4 01/02 15:04</span></div>
+func parsePushesHTML(doc *goquery.Document, posted time.Time) []PttPush {
+	var pushes []PttPush
+	doc.Find(".push").Each(func(i int, s *goquery.Selection) {
+		tag := strings.TrimSpace(s.Find(".push-tag").Text())
+		if tag == "" {
+			// "檔案過大！部分文章無法顯示" warnings share the push class.
+			return
+		}
+		pushes = append(pushes, newPttPush(tag,
+			s.Find(".push-userid").Text(),
+			s.Find(".push-content").Text(),
+			s.Find(".push-ipdatetime").Text(),
+			posted))
+	})
+	return pushes
+}
+
+// parsePushesMarkdown extracts the ordered push lines of an article markdown.
+func parsePushesMarkdown(markdown string, posted time.Time) []PttPush {
+	var pushes []PttPush
+	for _, match := range pushMarkdownRegex.FindAllStringSubmatch(markdown, -1) {
+		pushes = append(pushes, newPttPush(match[1], match[2], match[3], match[4], posted))
+	}
+	return pushes
+}
+
+// GetPushes returns all pushes of target article in order.
+func (p *PTT) GetPushes(target string) []PttPush {
+	pushes, err := p.GetPushesContext(context.Background(), target)
+	if err != nil {
+		log.Printf("GetPushes: %v", err)
+	}
+	return pushes
+}
+
+// GetPushesContext is the context-aware version of GetPushes.
+func (p *PTT) GetPushesContext(ctx context.Context, target string) ([]PttPush, error) {
+	article, err := p.fetchArticle(ctx, target)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching pushes of %s: %w", target, err)
+	}
+	return article.Pushes, nil
+}
@@ -0,0 +1,78 @@
+package photomgr
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestGetPushes_HTMLBackend(t *testing.T) {
+	server := newHTMLTestServer(t)
+	ptt := newHTMLTestPTT(server, PttBackendHTML)
+
+	pushes, err := ptt.GetPushesContext(context.Background(), server.URL+"/bbs/Beauty/M.1704067200.A.AAA.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []PttPush{
+		{Tag: PushLike, UserID: "pusher1", Text: "nice", IP: "5.6.7.8", DateTime: "01/01 08:10", Time: time.Date(2024, 1, 1, 8, 10, 0, 0, taiwanLocation)},
+		{Tag: PushDislike, UserID: "pusher2", Text: "bad", DateTime: "01/01 08:20", Time: time.Date(2024, 1, 1, 8, 20, 0, 0, taiwanLocation)},
+		{Tag: PushLike, UserID: "pusher3", Text: "great", DateTime: "01/02 09:00", Time: time.Date(2024, 1, 2, 9, 0, 0, 0, taiwanLocation)},
+	}
+	if len(pushes) != len(expected) {
+		t.Fatalf("Expected %d pushes, got %d: %+v", len(expected), len(pushes), pushes)
+	}
+	for i := range expected {
+		if pushes[i].Tag != expected[i].Tag || pushes[i].UserID != expected[i].UserID || pushes[i].Text != expected[i].Text ||
+			pushes[i].IP != expected[i].IP || pushes[i].DateTime != expected[i].DateTime || !pushes[i].Time.Equal(expected[i].Time) {
+			t.Errorf("Push %d: expected %+v, got %+v", i, expected[i], pushes[i])
+		}
+	}
+
+	summary := SummarizePushes(pushes)
+	if summary != (PttPushSummary{Total: 3, Like: 2, Dislike: 1, Score: 1, Users: 3}) {
+		t.Errorf("Unexpected summary: %+v", summary)
+	}
+}
+
+func TestParsePushesMarkdown(t *testing.T) {
+	markdown := `**Author**: user
+**Board**: Beauty
+**Title**: [正妹] Pushes
+**Date**: Sun Dec 31 23:00:00 2023
+
+Content.
+--
+※ 發信站: 批踢踢實業坊(ptt.cc), 來自: 1.2.3.4
+推 user1: Good post! 1.2.3.4 12/31 23:30
+→ user1: 補充: a: b 12/31 23:31
+噓 user2: Bad 01/01 00:10
+推 user3: no stamp
+`
+	article := parseArticleMarkdown(markdown, "https://www.ptt.cc/bbs/Beauty/M.1704034800.A.AAA.html")
+	if article.Content != "Content." {
+		t.Errorf("Unexpected content: %q", article.Content)
+	}
+	pushes := article.Pushes
+	if len(pushes) != 4 {
+		t.Fatalf("Expected 4 pushes, got %d: %+v", len(pushes), pushes)
+	}
+	if pushes[0].IP != "1.2.3.4" || pushes[0].Text != "Good post!" {
+		t.Errorf("Unexpected push 0: %+v", pushes[0])
+	}
+	if pushes[1].Tag != PushNeutral || pushes[1].Text != "補充: a: b" {
+		t.Errorf("Unexpected push 1: %+v", pushes[1])
+	}
+	// A push in January after a post in December belongs to the next year.
+	if !pushes[2].Time.Equal(time.Date(2024, 1, 1, 0, 10, 0, 0, taiwanLocation)) {
+		t.Errorf("Expected push 2 in 2024, got %v", pushes[2].Time)
+	}
+	if pushes[3].Text != "no stamp" || !pushes[3].Time.IsZero() {
+		t.Errorf("Unexpected push 3: %+v", pushes[3])
+	}
+
+	summary := SummarizePushes(pushes)
+	if summary.Like != 2 || summary.Dislike != 1 || summary.Neutral != 1 || summary.Users != 3 {
+		t.Errorf("Unexpected summary: %+v", summary)
+	}
+}
@@ -0,0 +1,160 @@
+package photomgr
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// ImagePending is the status of an image in a DownloadReport which was not
+// tried because the download was cancelled.
+const ImagePending = "pending"
+
+// ImageResult is the outcome of a single image of a download.
+type ImageResult struct {
+	URL    string `json:"url"`
+	Status string `json:"status"` // ImageDone, ImageSkipped, ImageFailed or ImagePending
+	// Path is the saved file, empty when the image is not saved or when it is
+	// only a reference to a duplicate, see DuplicateOf.
+	Path        string `json:"path,omitempty"`
+	Size        int64  `json:"size,omitempty"`
+	SHA256      string `json:"sha256,omitempty"`
+	Width       int    `json:"width,omitempty"`
+	Height      int    `json:"height,omitempty"`
+	DuplicateOf string `json:"duplicate_of,omitempty"`
+	// Skipped is the reason of a skipped image, such as "too small: 200x200".
+	Skipped string `json:"skipped,omitempty"`
+	// Err is the error of a failed image.
+	Err error `json:"-"`
+	// Resumed means the image was done or skipped by an earlier run, see
+	// Manifest.
+	Resumed bool `json:"resumed,omitempty"`
+}
+
+// DownloadReport is the result of downloading the images of a post.
+type DownloadReport struct {
+	Target string `json:"target"`
+	Title  string `json:"title"`
+	Dir    string `json:"dir"`
+	// Images are in post order.
+	Images   []ImageResult `json:"images"`
+	Started  time.Time     `json:"started"`
+	Finished time.Time     `json:"finished"`
+}
+
+// Count returns the number of images with status.
+func (r *DownloadReport) Count(status string) int {
+	n := 0
+	for _, image := range r.Images {
+		if image.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// Failures returns the failed images.
+func (r *DownloadReport) Failures() []ImageResult {
+	var failed []ImageResult
+	for _, image := range r.Images {
+		if image.Status == ImageFailed {
+			failed = append(failed, image)
+		}
+	}
+	return failed
+}
+
+// Skips returns the skipped images, see ImageResult.Skipped for the reason.
+func (r *DownloadReport) Skips() []ImageResult {
+	var skipped []ImageResult
+	for _, image := range r.Images {
+		if image.Status == ImageSkipped {
+			skipped = append(skipped, image)
+		}
+	}
+	return skipped
+}
+
+// Summary returns the image counts by status, such as
+// "12 images: 10 done, 1 skipped, 1 failed".
+func (r *DownloadReport) Summary() string {
+	s := fmt.Sprintf("%d images: %d done, %d skipped, %d failed",
+		len(r.Images), r.Count(ImageDone), r.Count(ImageSkipped), r.Count(ImageFailed))
+	if pending := r.Count(ImagePending); pending > 0 {
+		s += fmt.Sprintf(", %d pending", pending)
+	}
+	return s
+}
+
+// DownloadEventType is the kind of a DownloadEvent.
+type DownloadEventType int
+
+const (
+	// DownloadStarted is sent once the images of the post are known.
+	DownloadStarted DownloadEventType = iota
+	// DownloadProgress is sent after every image, done, skipped or failed.
+	DownloadProgress
+	// DownloadFinished is sent last with the report, even on cancel.
+	DownloadFinished
+)
+
+func (t DownloadEventType) String() string {
+	switch t {
+	case DownloadStarted:
+		return "started"
+	case DownloadProgress:
+		return "progress"
+	case DownloadFinished:
+		return "finished"
+	}
+	return fmt.Sprintf("DownloadEventType(%d)", int(t))
+}
+
+// DownloadEvent reports the progress of a download to a ProgressFunc.
+type DownloadEvent struct {
+	Type   DownloadEventType
+	Target string
+	Dir    string
+	// Total is the number of images of the post, Completed the number of
+	// them done, skipped or failed so far, including the resumed ones.
+	Total     int
+	Completed int
+	// Image is the completed image of a DownloadProgress event.
+	Image *ImageResult
+	// Report is the final report of a DownloadFinished event.
+	Report *DownloadReport
+}
+
+// ProgressFunc receives the events of a download. Calls are never concurrent,
+// so it needs no locking, but it should return quickly as the workers wait
+// for it. Use ProgressChan to receive the events on a channel instead.
+type ProgressFunc func(DownloadEvent)
+
+// ProgressChan returns a ProgressFunc sending every event to ch. The download
+// blocks while ch is full.
+func ProgressChan(ch chan<- DownloadEvent) ProgressFunc {
+	return func(event DownloadEvent) {
+		ch <- event
+	}
+}
+
+// resultFromManifest returns the result of an image recorded in an album
+// manifest, Path is resolved in album folder dir.
+func resultFromManifest(dir string, entry ManifestEntry) ImageResult {
+	result := ImageResult{
+		URL:         entry.URL,
+		Status:      entry.Status,
+		Size:        entry.Size,
+		SHA256:      entry.SHA256,
+		Width:       entry.Width,
+		Height:      entry.Height,
+		DuplicateOf: entry.DuplicateOf,
+	}
+	if entry.File != "" {
+		result.Path = filepath.Join(dir, entry.File)
+	}
+	if entry.Status == ImageSkipped {
+		result.Skipped = entry.Error
+	}
+	return result
+}
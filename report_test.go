@@ -0,0 +1,79 @@
+package photomgr
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestDownload_ReportAndProgress(t *testing.T) {
+	big := encodeTestImage(t, "jpg", 400, 400)
+	small := encodeTestImage(t, "png", 10, 10)
+
+	server := newCK101TestServer(t, map[string][]byte{"/big.jpg": big, "/small.png": small}, "/big.jpg", "/small.png", "/gone.jpg")
+
+	c := NewCK101()
+	c.BaseDir = t.TempDir()
+	target := server.URL + ck101TestThread
+
+	var events []DownloadEvent
+	report, err := c.Download(context.Background(), target, 2, func(event DownloadEvent) {
+		events = append(events, event)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Title != "Album" || report.Target != target || len(report.Images) != 3 {
+		t.Fatalf("Unexpected report: %+v", report)
+	}
+	if got := report.Images[0]; got.Status != ImageDone || got.Path != filepath.Join(report.Dir, "001.jpg") || got.Size != int64(len(big)) {
+		t.Errorf("Unexpected big image result: %+v", got)
+	}
+	if got := report.Images[1]; got.Status != ImageSkipped || got.Skipped != "too small: 10x10" || got.Path != "" {
+		t.Errorf("Unexpected small image result: %+v", got)
+	}
+	if got := report.Images[2]; got.Status != ImageFailed || !errors.Is(got.Err, ErrNotFound) {
+		t.Errorf("Unexpected gone image result: %+v", got)
+	}
+	if failures := report.Failures(); len(failures) != 1 || failures[0].URL != server.URL+"/gone.jpg" {
+		t.Errorf("Unexpected failures: %+v", failures)
+	}
+	if summary := report.Summary(); summary != "3 images: 1 done, 1 skipped, 1 failed" {
+		t.Errorf("Unexpected summary: %s", summary)
+	}
+
+	if len(events) != 5 {
+		t.Fatalf("Expected started, 3 progress and finished events, got %d", len(events))
+	}
+	if events[0].Type != DownloadStarted || events[0].Total != 3 || events[0].Completed != 0 {
+		t.Errorf("Unexpected started event: %+v", events[0])
+	}
+	for i, event := range events[1:4] {
+		if event.Type != DownloadProgress || event.Completed != i+1 || event.Image == nil {
+			t.Errorf("Unexpected progress event: %+v", event)
+		}
+	}
+	if last := events[4]; last.Type != DownloadFinished || last.Report != report || last.Completed != 3 {
+		t.Errorf("Unexpected finished event: %+v", last)
+	}
+
+	// Resumed images are reported from the manifest, only the failed one is
+	// tried again.
+	ch := make(chan DownloadEvent, 10)
+	report, err = c.Download(context.Background(), target, 2, ProgressChan(ch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	close(ch)
+	if !report.Images[0].Resumed || report.Images[0].Path == "" || !report.Images[1].Resumed || report.Images[2].Resumed {
+		t.Errorf("Unexpected resumed results: %+v", report.Images)
+	}
+	if started := <-ch; started.Type != DownloadStarted || started.Completed != 2 {
+		t.Errorf("Unexpected started event on resume: %+v", started)
+	}
+	if n := len(ch); n != 2 {
+		t.Errorf("Expected 1 progress and finished event on resume, got %d more events", n)
+	}
+}
@@ -0,0 +1,410 @@
+package photomgr
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// albumSites maps the folder name prefix of an album, as in "PTT - <title>",
+// to the site name.
+var albumSites = map[string]string{
+	"PTT":     "ptt",
+	"CK101":   "ck101",
+	"FBAlbum": "fbalbum",
+}
+
+// ScannedImage is an image file found in an album folder.
+type ScannedImage struct {
+	File string `json:"file"` // Name in the album folder
+	// URL is the source of the image from the manifest or post.json, empty
+	// if unknown.
+	URL    string    `json:"url,omitempty"`
+	Format string    `json:"format"` // File extension of the content, such as "jpg"
+	Size   int64     `json:"size"`
+	SHA256 string    `json:"sha256"`
+	Width  int       `json:"width"`
+	Height int       `json:"height"`
+	DHash  ImageHash `json:"dhash,omitempty"`
+}
+
+// ScannedAlbum is an album folder rebuilt from its name, image files and
+// sidecar files.
+type ScannedAlbum struct {
+	Dir   string `json:"dir"`
+	Site  string `json:"site"`
+	Title string `json:"title"`
+	// Meta is read from post.json, or built from the post found by
+	// RelinkAlbum. Nil when the source post is unknown.
+	Meta *PostMeta `json:"meta,omitempty"`
+	// Relinked means Meta was found by RelinkAlbum, not read from post.json.
+	Relinked bool `json:"relinked,omitempty"`
+	// Images are in post order when known, then by file name.
+	Images   []ScannedImage `json:"images"`
+	Modified time.Time      `json:"modified"`
+}
+
+// URL returns the source post of the album, empty if unknown.
+func (a *ScannedAlbum) URL() string {
+	if a.Meta == nil {
+		return ""
+	}
+	return a.Meta.URL
+}
+
+// ScanOptions configures ScanAlbums and ImportAlbums.
+type ScanOptions struct {
+	// Relink searches the title of PTT albums without post.json on the board
+	// of this PTT to find their source post, see RelinkAlbum. Nil disables
+	// re-linking, so nothing is fetched.
+	Relink *PTT
+}
+
+// ScanAlbums walks base folder root and rebuilds every album folder, see
+// ScanAlbum: the folders named "<site> - <title>" by the default naming
+// templates, and the folders with a post.json at any depth for the other
+// templates. An album which can not be read is logged and skipped. It stops
+// when ctx is done.
+func ScanAlbums(ctx context.Context, root string, opts ScanOptions) ([]*ScannedAlbum, error) {
+	var albums []*ScannedAlbum
+	err := filepath.WalkDir(root, func(dir string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !entry.IsDir() || dir == root {
+			return nil
+		}
+		if strings.HasPrefix(entry.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if !isAlbumDir(dir) {
+			return nil
+		}
+
+		album, err := ScanAlbum(dir)
+		if err != nil {
+			log.Printf("scan error: %s, album: %s", err, dir)
+			return filepath.SkipDir
+		}
+		if album.Meta == nil && album.Site == "ptt" && opts.Relink != nil {
+			if err := opts.Relink.RelinkAlbum(ctx, album); err != nil {
+				log.Printf("relink error: %s, album: %s", err, dir)
+			}
+		}
+		albums = append(albums, album)
+		return filepath.SkipDir // Albums are not nested
+	})
+	return albums, err
+}
+
+// isAlbumDir reports whether dir is an album folder, see ScanAlbums.
+func isAlbumDir(dir string) bool {
+	if _, _, ok := parseAlbumDirName(filepath.Base(dir)); ok {
+		return true
+	}
+	_, err := os.Stat(filepath.Join(dir, PostMetaFileName))
+	return err == nil
+}
+
+// parseAlbumDirName returns the site name and title of an album folder name
+// such as "PTT - [正妹] title".
+func parseAlbumDirName(name string) (site string, title string, ok bool) {
+	prefix, title, found := strings.Cut(name, " - ")
+	if !found || title == "" {
+		return "", "", false
+	}
+	site, ok = albumSites[prefix]
+	return site, title, ok
+}
+
+// ScanAlbum rebuilds the album of folder dir, named "<site> - <title>" by
+// the default naming templates or with a post.json: the hash, format and
+// dimensions of every image file, and the post of post.json if any. The
+// source URL of an image is taken from the manifest or post.json.
+func ScanAlbum(dir string) (*ScannedAlbum, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	album := &ScannedAlbum{Dir: dir, Images: []ScannedImage{}, Modified: info.ModTime()}
+	site, title, named := parseAlbumDirName(filepath.Base(dir))
+	album.Site, album.Title = site, title
+
+	// Position and source URL of the known files.
+	order := make(map[string]int)
+	urls := make(map[string]string)
+	meta, err := LoadPostMeta(dir)
+	switch {
+	case err == nil:
+		album.Meta = meta
+		for i, image := range meta.Images {
+			if image.File != "" {
+				order[image.File], urls[image.File] = i, image.URL
+			}
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		log.Printf("scan: ignore post meta of %s: %v", dir, err)
+	}
+	if !named {
+		if album.Meta == nil {
+			return nil, fmt.Errorf("%w: %s is not an album folder", ErrParseFailed, dir)
+		}
+		album.Site, album.Title = album.Meta.Site, album.Meta.Title
+	}
+	if manifest, err := LoadManifest(dir); err == nil {
+		// Entries are in the order recorded, manifests of earlier versions
+		// have no Seq.
+		for i, entry := range manifest.Entries {
+			seq := i
+			if entry.Seq > 0 {
+				seq = entry.Seq - 1
+			}
+			if _, ok := order[entry.File]; entry.File != "" && !ok {
+				order[entry.File], urls[entry.File] = seq, entry.URL
+			}
+		}
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		name := file.Name()
+		if !file.Type().IsRegular() || strings.HasPrefix(name, ".") || name == ManifestFileName || name == PostMetaFileName || name == AlbumIndexFileName {
+			continue
+		}
+		image, err := scanImage(filepath.Join(dir, name))
+		if err != nil {
+			log.Printf("scan: skip %s: %v", filepath.Join(dir, name), err)
+			continue
+		}
+		if image == nil {
+			continue // Not an image
+		}
+		image.URL = urls[name]
+		album.Images = append(album.Images, *image)
+	}
+
+	sort.SliceStable(album.Images, func(i, j int) bool {
+		oi, iKnown := order[album.Images[i].File]
+		oj, jKnown := order[album.Images[j].File]
+		switch {
+		case iKnown && jKnown:
+			return oi < oj
+		case iKnown != jKnown:
+			return iKnown
+		}
+		return album.Images[i].File < album.Images[j].File
+	})
+	return album, nil
+}
+
+// scanImage hashes the image file at path and reads its dimensions. It
+// returns nil for files which are not images.
+func scanImage(path string) (*ScannedImage, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	format := sniffImageFormat(head[:n])
+	if format == "" {
+		return nil, nil
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	cfg, err := decodeImageConfig(f, format)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s config: %v", ErrParseFailed, format, err)
+	}
+
+	image := &ScannedImage{
+		File:   filepath.Base(path),
+		Format: format,
+		Size:   size,
+		SHA256: hex.EncodeToString(hash.Sum(nil)),
+		Width:  cfg.Width,
+		Height: cfg.Height,
+	}
+	// Only the standard formats can be decoded for the perceptual hash.
+	if dhash, err := DHashFile(path); err == nil {
+		image.DHash = dhash
+	}
+	return image, nil
+}
+
+// titleCategoryRegex matches the category of a post title, as in
+// "[正妹] title".
+var titleCategoryRegex = regexp.MustCompile(`^\s*(?:Re:\s*)?\[[^\]]*\]\s*`)
+
+// RelinkAlbum finds the source post of a PTT album by searching its title
+// on the board, like ParseSearchByKeyword, and sets the album Meta from the
+// post with the same title. It returns an error wrapping ErrNotFound when no
+// single post has the title.
+func (p *PTT) RelinkAlbum(ctx context.Context, album *ScannedAlbum) error {
+	keyword := strings.TrimSpace(titleCategoryRegex.ReplaceAllString(album.Title, ""))
+	if keyword == "" {
+		keyword = album.Title
+	}
+	posts, err := p.SearchContext(ctx, keyword)
+	if err != nil {
+		return err
+	}
+
+	var found []PostDoc
+	for _, post := range posts {
+		if strings.TrimSpace(post.ArticleTitle) == strings.TrimSpace(album.Title) {
+			found = append(found, post)
+		}
+	}
+	if len(found) != 1 {
+		return fmt.Errorf("%w: %d posts titled %q on %s", ErrNotFound, len(found), album.Title, p.Board)
+	}
+
+	post := found[0]
+	album.Meta = &PostMeta{
+		Site:      p.Name(),
+		ArticleID: post.ArticleID,
+		URL:       post.URL,
+		Title:     post.ArticleTitle,
+		Author:    post.Author,
+		Board:     p.Board,
+		Date:      post.Date,
+		Time:      post.Time,
+		Like:      post.Likeint,
+		Dislike:   post.Dislikeint,
+	}
+	album.Relinked = true
+	return nil
+}
+
+// ImportAlbums scans base folder root like ScanAlbums and bootstraps the
+// library and the catalog of root from the albums found: every image is
+// indexed for deduplication, every album with a known source post is
+// cataloged unless it already is, and re-linked albums get a post.json.
+func ImportAlbums(ctx context.Context, root string, opts ScanOptions) ([]*ScannedAlbum, error) {
+	albums, err := ScanAlbums(ctx, root, opts)
+	if err != nil && len(albums) == 0 {
+		return nil, err
+	}
+	lib, libErr := OpenLibrary(root)
+	if libErr != nil {
+		return albums, libErr
+	}
+	catalog, catalogErr := OpenCatalog(root)
+	if catalogErr != nil {
+		return albums, catalogErr
+	}
+
+	for _, album := range albums {
+		for _, image := range album.Images {
+			path := filepath.Join(album.Dir, image.File)
+			if _, ok := lib.Lookup(image.SHA256); ok {
+				continue
+			}
+			entry := LibraryEntry{SHA256: image.SHA256, Size: image.Size, Width: image.Width, Height: image.Height, DHash: image.DHash}
+			if err := lib.Add(path, entry); err != nil {
+				log.Printf("library error: %s, file: %s", err, path)
+			}
+		}
+
+		if album.Meta == nil {
+			continue
+		}
+		if album.Relinked {
+			album.Meta.Images = make([]PostMetaImage, 0, len(album.Images))
+			for _, image := range album.Images {
+				album.Meta.Images = append(album.Meta.Images, PostMetaImage{URL: image.URL, Status: ImageDone, File: image.File})
+			}
+			album.Meta.CrawledAt = album.Modified
+			if err := writePostMeta(album.Dir, album.Meta); err != nil {
+				log.Printf("post meta error: %s, album: %s", err, album.Dir)
+			}
+		}
+		if err := catalog.importAlbum(album); err != nil {
+			log.Printf("catalog error: %s, album: %s", err, album.Dir)
+		}
+	}
+	return albums, err
+}
+
+// importAlbum catalogs a scanned album with a known source post. A post
+// already in the catalog is kept, as its download recorded more, such as the
+// skipped and failed images.
+func (c *Catalog) importAlbum(album *ScannedAlbum) error {
+	meta := album.Meta
+	if _, err := c.Post(meta.URL); err == nil {
+		return nil
+	}
+	post := CatalogPost{
+		PostDoc: PostDoc{
+			ArticleID:    meta.ArticleID,
+			ArticleTitle: meta.Title,
+			Author:       meta.Author,
+			Date:         meta.Date,
+			URL:          meta.URL,
+			ImageLinks:   make([]string, 0, len(meta.Images)),
+			Likeint:      meta.Like,
+			Dislikeint:   meta.Dislike,
+			Time:         meta.Time,
+		},
+		Site:      album.Site,
+		Board:     meta.Board,
+		Dir:       c.rel(album.Dir),
+		CrawledAt: meta.CrawledAt,
+	}
+	if post.CrawledAt.IsZero() {
+		post.CrawledAt = album.Modified
+	}
+	for _, image := range meta.Images {
+		post.ImageLinks = append(post.ImageLinks, image.URL)
+	}
+
+	images := make([]CatalogImage, 0, len(album.Images))
+	for _, image := range album.Images {
+		images = append(images, CatalogImage{
+			URL:    image.URL,
+			Status: ImageDone,
+			Path:   c.rel(filepath.Join(album.Dir, image.File)),
+			SHA256: image.SHA256,
+			Width:  image.Width,
+			Height: image.Height,
+			Size:   image.Size,
+		})
+	}
+	if err := c.PutPost(post); err != nil {
+		return err
+	}
+	return c.PutImages(post.URL, images)
+}
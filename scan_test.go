@@ -0,0 +1,154 @@
+package photomgr
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestAlbum(t *testing.T, dir string, files map[string][]byte) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestScanAlbum(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "PTT - [正妹] Scanned")
+	writeTestAlbum(t, dir, map[string][]byte{
+		"a.jpg":     encodeTestImage(t, "jpg", 400, 300),
+		"b.png":     encodeTestImage(t, "png", 20, 10),
+		"extra.gif": encodeTestImage(t, "gif", 5, 5),
+		"notes.txt": []byte("not an image"),
+	})
+	// post.json orders b.png before a.jpg, extra.gif is unknown so last.
+	meta := &PostMeta{Site: "ptt", URL: "https://www.ptt.cc/bbs/Beauty/M.1.A.AAA.html", Title: "[正妹] Scanned",
+		Images: []PostMetaImage{{URL: "https://i.imgur.com/b.png", Status: ImageDone, File: "b.png"}, {URL: "https://i.imgur.com/a.jpg", Status: ImageDone, File: "a.jpg"}}}
+	if err := writePostMeta(dir, meta); err != nil {
+		t.Fatal(err)
+	}
+
+	album, err := ScanAlbum(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if album.Site != "ptt" || album.Title != "[正妹] Scanned" || album.URL() != meta.URL || album.Relinked {
+		t.Errorf("Unexpected album: %+v", album)
+	}
+	var files []string
+	for _, image := range album.Images {
+		files = append(files, image.File)
+	}
+	if fmt.Sprint(files) != "[b.png a.jpg extra.gif]" {
+		t.Fatalf("Expected images [b.png a.jpg extra.gif], got %v", files)
+	}
+	a := album.Images[1]
+	if a.URL != "https://i.imgur.com/a.jpg" || a.Format != "jpg" || a.Width != 400 || a.Height != 300 || a.Size == 0 || len(a.SHA256) != 64 {
+		t.Errorf("Unexpected scanned image: %+v", a)
+	}
+
+	if _, err := ScanAlbum(t.TempDir()); err == nil {
+		t.Error("Expected an error for a folder which is not an album")
+	}
+}
+
+func TestScanAlbum_ManifestSeq(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "CK101 - Album")
+	writeTestAlbum(t, dir, map[string][]byte{
+		"001.jpg": encodeTestImage(t, "jpg", 400, 400),
+		"002.jpg": encodeTestImage(t, "jpg", 500, 400),
+	})
+	// The second image finished first.
+	manifest, err := LoadManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest.Record(ManifestEntry{URL: "https://example.com/b.jpg", Status: ImageDone, Seq: 2, File: "002.jpg"})
+	manifest.Record(ManifestEntry{URL: "https://example.com/a.jpg", Status: ImageDone, Seq: 1, File: "001.jpg"})
+
+	album, err := ScanAlbum(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(album.Images) != 2 || album.Images[0].URL != "https://example.com/a.jpg" || album.Images[1].URL != "https://example.com/b.jpg" {
+		t.Errorf("Expected the images in post order, got %+v", album.Images)
+	}
+}
+
+func TestImportAlbums_Relink(t *testing.T) {
+	var searches []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		searches = append(searches, r.URL.Query().Get("q"))
+		w.Write([]byte(`<html><body>
+			<div class="r-ent"><div class="nrec">12</div><div class="title"><a href="/bbs/Beauty/M.1704067200.A.AAA.html">[正妹] Old album</a></div><div class="meta"><div class="author">olduser</div><div class="date"> 1/01</div></div></div>
+			<div class="r-ent"><div class="nrec">3</div><div class="title"><a href="/bbs/Beauty/M.1704067300.A.BBB.html">[正妹] Old album 2</a></div><div class="meta"><div class="author">other</div><div class="date"> 1/01</div></div></div>
+		</body></html>`))
+	}))
+	defer server.Close()
+	ptt := newHTMLTestPTT(server, PttBackendHTML)
+
+	root := t.TempDir()
+	image := encodeTestImage(t, "png", 400, 400)
+	writeTestAlbum(t, filepath.Join(root, "PTT - [正妹] Old album"), map[string][]byte{"1.png": image})
+	writeTestAlbum(t, filepath.Join(root, "PTT - [正妹] Unknown"), map[string][]byte{"1.png": image})
+	writeTestAlbum(t, filepath.Join(root, "CK101 - Thread"), map[string][]byte{"1.jpg": encodeTestImage(t, "jpg", 300, 300)})
+	writeTestAlbum(t, filepath.Join(root, "Other folder"), map[string][]byte{"1.png": image})
+
+	albums, err := ImportAlbums(context.Background(), root, ScanOptions{Relink: ptt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(albums) != 3 {
+		t.Fatalf("Expected 3 albums, got %d", len(albums))
+	}
+	// The CK101 album is not searched, the category is not in the keyword.
+	if fmt.Sprint(searches) != "[Old album Unknown]" {
+		t.Errorf("Expected searches [Old album Unknown], got %v", searches)
+	}
+
+	old := albums[1]
+	if old.Title != "[正妹] Old album" || !old.Relinked || old.Meta.Author != "olduser" ||
+		old.URL() != server.URL+"/bbs/Beauty/M.1704067200.A.AAA.html" {
+		t.Fatalf("Expected the album linked to its post, got %+v", old)
+	}
+	if albums[2].Meta != nil {
+		t.Errorf("Expected no post for the unknown album, got %+v", albums[2].Meta)
+	}
+
+	// The re-linked album gets a post.json and is cataloged.
+	meta, err := LoadPostMeta(old.Dir)
+	if err != nil || meta.URL != old.URL() || len(meta.Images) != 1 {
+		t.Errorf("Expected post meta of the relinked album, got %+v, err %v", meta, err)
+	}
+	catalog, err := OpenCatalog(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer catalog.Close()
+	posts, err := catalog.Posts(CatalogQuery{})
+	if err != nil || len(posts) != 1 || posts[0].Board != "Beauty" || posts[0].Likeint != 12 || posts[0].Time.IsZero() {
+		t.Errorf("Expected the relinked post in the catalog, got %+v, err %v", posts, err)
+	}
+	images, err := catalog.Images(old.URL())
+	if err != nil || len(images) != 1 || images[0].Path != "PTT - [正妹] Old album/1.png" || images[0].Width != 400 {
+		t.Errorf("Unexpected cataloged images %+v, err %v", images, err)
+	}
+
+	// Every distinct image is in the library, the repost once.
+	lib, err := OpenLibrary(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lib.Len() != 2 {
+		t.Errorf("Expected 2 library images, got %d", lib.Len())
+	}
+}
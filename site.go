@@ -0,0 +1,127 @@
+package photomgr
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Site is the common behaviour shared by every supported photo site (PTT,
+// CK101, FBAlbum ...). The Parse listing methods store their result in the
+// crawler, so the post details can be read back with the index getters. The
+// List and Search methods return the posts instead, and are safe to use from
+// many goroutines.
+//
+// Every network method has a Context variant which returns the error instead
+// of logging it; the errors wrap ErrNotFound, ErrRateLimited, ErrParseFailed,
+// ErrNotSupported or ErrNoFirecrawlKey when applicable.
+type Site interface {
+	// Name returns the registered name of the site, such as "ptt".
+	Name() string
+
+	// SetBaseDir sets the folder where downloaded albums are stored.
+	SetBaseDir(dir string)
+
+	// HasValidURL reports whether url is a post that can be downloaded.
+	HasValidURL(url string) bool
+
+	// ParsePageByIndex fetches board page by index and returns the post count.
+	// Page 0 is the newest page, page n is n pages older than the newest.
+	ParsePageByIndex(page int) int
+
+	// ParseSearchByKeyword searches posts by keyword and returns the post count.
+	ParseSearchByKeyword(keyword string) int
+
+	// ListPage returns the posts of board page by index like
+	// ParsePageByIndex, without storing them.
+	ListPage(page int) ([]PostDoc, error)
+
+	// Search returns the posts matching keyword like ParseSearchByKeyword,
+	// without storing them.
+	Search(keyword string) ([]PostDoc, error)
+
+	// Index getters for the result of the last listing call.
+	GetCurrentPageResultCount() int
+	GetPostTitleByIndex(postIndex int) string
+	GetPostUrlByIndex(postIndex int) string
+	GetPostStarByIndex(postIndex int) int
+
+	// GetUrlTitle fetches a single post and returns its title.
+	GetUrlTitle(target string) string
+
+	// GetAllImageAddress returns all image address of a single post.
+	GetAllImageAddress(target string) []string
+
+	// Crawler downloads all images of a post into BaseDir. The images are
+	// downloaded by the shared DefaultDownloadManager, workerNum limits how
+	// many of them are in flight at once.
+	Crawler(target string, workerNum int)
+
+	ParsePageByIndexContext(ctx context.Context, page int) (int, error)
+	ParseSearchByKeywordContext(ctx context.Context, keyword string) (int, error)
+	ListPageContext(ctx context.Context, page int) ([]PostDoc, error)
+	SearchContext(ctx context.Context, keyword string) ([]PostDoc, error)
+	GetUrlTitleContext(ctx context.Context, target string) (string, error)
+	GetAllImageAddressContext(ctx context.Context, target string) ([]string, error)
+	CrawlerContext(ctx context.Context, target string, workerNum int) error
+
+	// Download is CrawlerContext returning the result of every image, and
+	// sending events to progress if not nil. The report is returned with
+	// the error when the download was started, such as on cancel.
+	Download(ctx context.Context, target string, workerNum int, progress ProgressFunc) (*DownloadReport, error)
+}
+
+var (
+	sitesMu sync.RWMutex
+	sites   = make(map[string]func() Site)
+)
+
+// RegisterSite makes a site available by name through NewSite. It is called
+// from init of every site implementation, and panics on duplicate names.
+func RegisterSite(name string, factory func() Site) {
+	sitesMu.Lock()
+	defer sitesMu.Unlock()
+
+	name = strings.ToLower(name)
+	if factory == nil {
+		panic("photomgr: RegisterSite factory is nil")
+	}
+	if _, dup := sites[name]; dup {
+		panic("photomgr: RegisterSite called twice for " + name)
+	}
+	sites[name] = factory
+}
+
+// NewSite returns a new instance of the site registered as name.
+func NewSite(name string) (Site, error) {
+	sitesMu.RLock()
+	factory, ok := sites[strings.ToLower(name)]
+	sitesMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown site %q, available: %s", name, strings.Join(SiteNames(), ", "))
+	}
+	return factory(), nil
+}
+
+// SiteNames returns the sorted names of all registered sites.
+func SiteNames() []string {
+	sitesMu.RLock()
+	defer sitesMu.RUnlock()
+
+	names := make([]string, 0, len(sites))
+	for name := range sites {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Make sure all sites implement Site.
+var (
+	_ Site = (*PTT)(nil)
+	_ Site = (*CK101)(nil)
+	_ Site = (*FBAlbum)(nil)
+)
@@ -0,0 +1,29 @@
+package photomgr
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewSite(t *testing.T) {
+	for _, name := range []string{"ptt", "PTT", "ck101", "fbalbum"} {
+		site, err := NewSite(name)
+		if err != nil {
+			t.Fatalf("NewSite(%q) returned error: %v", name, err)
+		}
+		if site.Name() == "" {
+			t.Errorf("NewSite(%q) returned site without name", name)
+		}
+	}
+
+	if _, err := NewSite("unknown"); err == nil {
+		t.Error("expected an error for unknown site, but got nil")
+	}
+}
+
+func TestSiteNames(t *testing.T) {
+	expected := []string{"ck101", "fbalbum", "ptt"}
+	if names := SiteNames(); !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected site names %v, got %v", expected, names)
+	}
+}